@@ -20,6 +20,7 @@ import (
 	"go.opentelemetry.io/collector/confmap/provider/envprovider"
 	"go.opentelemetry.io/collector/confmap/provider/fileprovider"
 	"go.opentelemetry.io/collector/confmap/provider/yamlprovider"
+	"go.opentelemetry.io/collector/connector"
 	"go.opentelemetry.io/collector/exporter"
 	"go.opentelemetry.io/collector/exporter/debugexporter"
 	"go.opentelemetry.io/collector/exporter/otlpexporter"
@@ -111,6 +112,9 @@ func components() (otelcol.Factories, error) {
 	sc := spancounter.NewFactory()
 	factories.Processors[sc.Type()] = sc
 
+	scc := spancounter.NewConnectorFactory()
+	factories.Connectors[scc.Type()] = scc
+
 	fp := filterprocessor.NewFactory()
 	factories.Processors[fp.Type()] = fp
 
@@ -163,11 +167,15 @@ func defaultComponents() (otelcol.Factories, error) {
 	)
 	errs = multierr.Append(errs, err)
 
+	connectors, err := connector.MakeFactoryMap()
+	errs = multierr.Append(errs, err)
+
 	factories := otelcol.Factories{
 		Extensions: extensions,
 		Receivers:  receivers,
 		Processors: processors,
 		Exporters:  exporters,
+		Connectors: connectors,
 	}
 
 	return factories, errs
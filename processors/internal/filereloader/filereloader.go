@@ -0,0 +1,100 @@
+// Package filereloader keeps in memory state in sync with a file on disk.
+package filereloader
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reloader loads a file on start and reloads it every interval when its
+// modification time changed. A failed reload is logged and the previously
+// loaded content stays in use.
+type Reloader struct {
+	path     string
+	interval time.Duration
+	load     func(data []byte) error
+	logger   *zap.Logger
+
+	modTime time.Time
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New returns a Reloader that passes the file content to load.
+func New(path string, interval time.Duration, load func(data []byte) error, logger *zap.Logger) *Reloader {
+	return &Reloader{
+		path:     path,
+		interval: interval,
+		load:     load,
+		logger:   logger,
+	}
+}
+
+// Start loads the file once and fails when it can't be loaded.
+func (r *Reloader) Start() error {
+	if err := r.reload(); err != nil {
+		return err
+	}
+	if r.interval <= 0 {
+		return nil
+	}
+
+	r.done = make(chan struct{})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.reloadIfModified(); err != nil {
+					r.logger.Error("failed to reload file", zap.String("path", r.path), zap.Error(err))
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops polling the file.
+func (r *Reloader) Shutdown() {
+	if r.done != nil {
+		close(r.done)
+		r.wg.Wait()
+		r.done = nil
+	}
+}
+
+func (r *Reloader) reloadIfModified() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(r.modTime) {
+		return nil
+	}
+	return r.reload()
+}
+
+func (r *Reloader) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	if err := r.load(data); err != nil {
+		return fmt.Errorf("failed to load %s: %w", r.path, err)
+	}
+	r.modTime = info.ModTime()
+	return nil
+}
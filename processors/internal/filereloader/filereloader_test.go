@@ -0,0 +1,47 @@
+package filereloader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(path, []byte("one"), 0o600))
+
+	var content atomic.Value
+	r := New(path, 10*time.Millisecond, func(data []byte) error {
+		if len(data) == 0 {
+			return errors.New("empty")
+		}
+		content.Store(string(data))
+		return nil
+	}, zap.NewNop())
+	require.NoError(t, r.Start())
+	defer r.Shutdown()
+	assert.Equal(t, "one", content.Load())
+
+	// A failed reload keeps the previous content.
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "one", content.Load())
+
+	require.NoError(t, os.WriteFile(path, []byte("two"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	assert.Eventually(t, func() bool { return content.Load() == "two" }, time.Second, 10*time.Millisecond)
+}
+
+func TestReloaderMissingFile(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "missing"), time.Second, func([]byte) error { return nil }, zap.NewNop())
+	assert.Error(t, r.Start())
+	r.Shutdown()
+}
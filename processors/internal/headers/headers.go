@@ -0,0 +1,29 @@
+// Package headers reads request headers from the context of a pipeline call.
+package headers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/client"
+	"google.golang.org/grpc/metadata"
+)
+
+// Get returns the values of the request header key.
+// gRPC receivers expose headers as incoming gRPC metadata, HTTP receivers
+// (OTLP/HTTP, Zipkin, Jaeger Thrift HTTP) expose them through client.Info
+// when include_metadata is set. gRPC metadata is looked up first.
+// ok is false when the context carries neither gRPC metadata nor client info.
+func Get(ctx context.Context, key string) (values []string, ok bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		if values = md.Get(key); len(values) > 0 {
+			return values, true
+		}
+	}
+
+	info := client.FromContext(ctx)
+	if values = info.Metadata.Get(key); len(values) > 0 {
+		return values, true
+	}
+	return nil, ok || info.Addr != nil
+}
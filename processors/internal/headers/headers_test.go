@@ -0,0 +1,68 @@
+package headers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/client"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGet(t *testing.T) {
+	grpcCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"x-tenant-id": "grpc"}))
+	clientInfo := client.Info{
+		Addr:     &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Metadata: client.NewMetadata(map[string][]string{"X-Tenant-Id": {"http"}}),
+	}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		wantValues []string
+		wantOk     bool
+	}{
+		{
+			name:   "no metadata",
+			ctx:    context.Background(),
+			wantOk: false,
+		},
+		{
+			name:       "grpc metadata",
+			ctx:        grpcCtx,
+			wantValues: []string{"grpc"},
+			wantOk:     true,
+		},
+		{
+			name:       "client metadata",
+			ctx:        client.NewContext(context.Background(), clientInfo),
+			wantValues: []string{"http"},
+			wantOk:     true,
+		},
+		{
+			name:       "grpc metadata first",
+			ctx:        client.NewContext(grpcCtx, clientInfo),
+			wantValues: []string{"grpc"},
+			wantOk:     true,
+		},
+		{
+			name:       "client metadata when missing in grpc metadata",
+			ctx:        client.NewContext(metadata.NewIncomingContext(context.Background(), metadata.MD{}), clientInfo),
+			wantValues: []string{"http"},
+			wantOk:     true,
+		},
+		{
+			name:   "client info without metadata",
+			ctx:    client.NewContext(context.Background(), client.Info{Addr: clientInfo.Addr}),
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, ok := Get(tt.ctx, "x-tenant-id")
+			assert.Equal(t, tt.wantValues, values)
+			assert.Equal(t, tt.wantOk, ok)
+		})
+	}
+}
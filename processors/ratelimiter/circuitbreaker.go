@@ -0,0 +1,88 @@
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultProbeInterval = 10 * time.Second
+
+var errCircuitBreakerOpen = errors.New("rate limit service circuit breaker is open")
+
+// circuitBreaker opens after failureThreshold consecutive failures. While open,
+// a single call is allowed every probeInterval, a successful one closes it.
+type circuitBreaker struct {
+	failureThreshold int
+	probeInterval    time.Duration
+	// onStateChange is called without holding the lock whenever the breaker
+	// opens or closes, err is the failure that opened it.
+	onStateChange func(open bool, err error)
+	now           func() time.Time
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	open                bool
+	probing             bool
+	nextProbe           time.Time
+}
+
+// newCircuitBreaker returns nil when the breaker is disabled.
+func newCircuitBreaker(cfg CircuitBreakerConfig, onStateChange func(open bool, err error)) *circuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		return nil
+	}
+	probeInterval := cfg.ProbeInterval
+	if probeInterval == 0 {
+		probeInterval = defaultProbeInterval
+	}
+	return &circuitBreaker{
+		failureThreshold: cfg.FailureThreshold,
+		probeInterval:    probeInterval,
+		onStateChange:    onStateChange,
+		now:              time.Now,
+	}
+}
+
+// allow reports whether the rate limit service may be called.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || b.now().Before(b.nextProbe) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	wasOpen := b.open
+	b.consecutiveFailures = 0
+	b.open = false
+	b.probing = false
+	b.mu.Unlock()
+
+	if wasOpen {
+		b.onStateChange(false, nil)
+	}
+}
+
+func (b *circuitBreaker) failure(err error) {
+	b.mu.Lock()
+	b.consecutiveFailures++
+	opened := !b.open && b.consecutiveFailures >= b.failureThreshold
+	if opened || b.probing {
+		b.open = true
+		b.probing = false
+		b.nextProbe = b.now().Add(b.probeInterval)
+	}
+	b.mu.Unlock()
+
+	if opened {
+		b.onStateChange(true, err)
+	}
+}
@@ -0,0 +1,51 @@
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	assert.Nil(t, newCircuitBreaker(CircuitBreakerConfig{}, nil))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var states []bool
+	b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, ProbeInterval: time.Second}, func(open bool, _ error) {
+		states = append(states, open)
+	})
+	require.NotNil(t, b)
+	now := time.Unix(0, 0)
+	b.now = func() time.Time { return now }
+	errRLS := errors.New("unavailable")
+
+	assert.True(t, b.allow())
+	b.failure(errRLS)
+	assert.True(t, b.allow())
+	b.success()
+	b.failure(errRLS)
+	assert.True(t, b.allow())
+	b.failure(errRLS)
+	assert.Equal(t, []bool{true}, states)
+
+	// Open, no calls until the probe interval elapsed.
+	assert.False(t, b.allow())
+	now = now.Add(time.Second)
+	// A single probe is allowed.
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+	b.failure(errRLS)
+	assert.False(t, b.allow())
+	assert.Equal(t, []bool{true}, states)
+
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	b.success()
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+	assert.Equal(t, []bool{true, false}, states)
+}
@@ -0,0 +1,110 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	pb_struct "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const defaultFlushInterval = 100 * time.Millisecond
+
+// hitsCoalescer accumulates the hits per descriptor and reports them to the
+// rate limit service once per interval, in a single call per descriptor.
+type hitsCoalescer struct {
+	interval time.Duration
+	report   func(ctx context.Context, key string, hits *pendingHits)
+
+	mu      sync.Mutex
+	pending map[string]*pendingHits
+
+	started bool
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// pendingHits are the hits of a descriptor not reported yet.
+type pendingHits struct {
+	entries    []*pb_struct.RateLimitDescriptor_Entry
+	tenantAttr metric.MeasurementOption
+	hits       uint64
+}
+
+func newHitsCoalescer(interval time.Duration, report func(ctx context.Context, key string, hits *pendingHits)) *hitsCoalescer {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	return &hitsCoalescer{
+		interval: interval,
+		report:   report,
+		pending:  map[string]*pendingHits{},
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+}
+
+func (c *hitsCoalescer) add(key string, entries []*pb_struct.RateLimitDescriptor_Entry, tenantAttr metric.MeasurementOption, hits uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending, ok := c.pending[key]
+	if !ok {
+		pending = &pendingHits{entries: entries, tenantAttr: tenantAttr}
+		c.pending[key] = pending
+	}
+	pending.hits += uint64(hits)
+}
+
+func (c *hitsCoalescer) start() {
+	c.started = true
+	go func() {
+		defer close(c.doneCh)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.flush()
+			case <-c.stopCh:
+				c.flush()
+				return
+			}
+		}
+	}()
+}
+
+// shutdown stops the background reports after reporting the pending hits.
+func (c *hitsCoalescer) shutdown() {
+	if !c.started {
+		return
+	}
+	close(c.stopCh)
+	<-c.doneCh
+}
+
+// flush reports and clears the pending hits.
+func (c *hitsCoalescer) flush() {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[string]*pendingHits, len(pending))
+	c.mu.Unlock()
+	for key, hits := range pending {
+		c.report(context.Background(), key, hits)
+	}
+}
+
+// reportHits reports coalesced hits to the rate limit service. Over limit decisions
+// are cached until the limit resets, or until the next report when the service
+// doesn't tell, and applied to the following requests.
+func (p *rateLimiterProcessor) reportHits(ctx context.Context, key string, hits *pendingHits) {
+	addend := uint32(math.MaxUint32)
+	if hits.hits < math.MaxUint32 {
+		addend = uint32(hits.hits)
+	}
+	overLimit, untilReset := p.callRateLimitService(ctx, hits.tenantAttr, key, hits.entries, addend)
+	if overLimit && untilReset <= 0 {
+		p.overLimitCache.add(key, p.coalescer.interval)
+	}
+}
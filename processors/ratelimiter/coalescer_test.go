@@ -0,0 +1,154 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb_struct "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	internalmetadata "github.com/hypertrace/collector/processors/ratelimiter/internal/metadata"
+	"github.com/hypertrace/collector/processors/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestHitsCoalescer(t *testing.T) {
+	reported := map[string]uint64{}
+	c := newHitsCoalescer(time.Hour, func(_ context.Context, key string, hits *pendingHits) {
+		reported[key] = hits.hits
+	})
+	entries := []*pb_struct.RateLimitDescriptor_Entry{{Key: TenantSpans, Value: testTenantID}}
+	c.add("a", entries, nil, 2)
+	c.add("a", entries, nil, 3)
+	c.add("b", entries, nil, 1)
+	c.flush()
+	assert.Equal(t, map[string]uint64{"a": 5, "b": 1}, reported)
+
+	// Reported hits are not reported again.
+	reported = map[string]uint64{}
+	c.flush()
+	assert.Empty(t, reported)
+}
+
+func TestHitsCoalescerShutdown(t *testing.T) {
+	var reported atomic.Uint64
+	c := newHitsCoalescer(time.Hour, func(_ context.Context, _ string, hits *pendingHits) {
+		reported.Add(hits.hits)
+	})
+	// Shutdown without start returns.
+	newHitsCoalescer(0, nil).shutdown()
+
+	c.start()
+	c.add("a", nil, nil, 4)
+	c.shutdown()
+	assert.Equal(t, uint64(4), reported.Load())
+}
+
+func TestRateLimitingCoalesced(t *testing.T) {
+	mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+	tracesSink := new(consumertest.TracesSink)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:                     zap.NewNop(),
+		tenantIDHeaderName:         defaultHeaderName,
+		domain:                     defaultDomain,
+		rateLimitServiceClient:     mockRateLimitServiceClientObj,
+		rateLimitServiceClientConn: &grpc.ClientConn{},
+		nextConsumer:               tracesSink,
+		telemetryBuilder:           telemetryBuilder,
+		overLimitCache:             newOverLimitCache(),
+	}
+	p.coalescer = newHitsCoalescer(time.Hour, p.reportHits)
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.MatchedBy(func(req *pb.RateLimitRequest) bool {
+		return req.HitsAddend == 3
+	})).Return(&pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+		Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OVER_LIMIT}},
+	}, nil)
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+	)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan())))
+	}
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 0)
+	assert.Len(t, tracesSink.AllTraces(), 3)
+
+	p.coalescer.flush()
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 1)
+	// The over limit decision applies until the next report.
+	require.NoError(t, p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan())))
+	assert.Len(t, tracesSink.AllTraces(), 3)
+}
+
+// countingRateLimitServiceClient allows everything and counts the calls.
+type countingRateLimitServiceClient struct {
+	calls atomic.Int64
+}
+
+func (c *countingRateLimitServiceClient) ShouldRateLimit(context.Context, *pb.RateLimitRequest, ...grpc.CallOption) (*pb.RateLimitResponse, error) {
+	c.calls.Add(1)
+	// Simulate the round trip to the rate limit service.
+	time.Sleep(100 * time.Microsecond)
+	return &pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OK,
+		Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OK}},
+	}, nil
+}
+
+// BenchmarkRateLimiting compares the rate limit service calls per batch with and
+// without coalescing, reported as rpcs/op.
+func BenchmarkRateLimiting(b *testing.B) {
+	for _, coalesced := range []bool{false, true} {
+		name := "sync"
+		if coalesced {
+			name = "coalesced"
+		}
+		b.Run(name, func(b *testing.B) {
+			client := &countingRateLimitServiceClient{}
+			telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+			require.NoError(b, err)
+			p := &rateLimiterProcessor{
+				logger:                 zap.NewNop(),
+				tenantIDHeaderName:     defaultHeaderName,
+				domain:                 defaultDomain,
+				rateLimitServiceClient: client,
+				nextConsumer:           consumertest.NewNop(),
+				telemetryBuilder:       telemetryBuilder,
+				overLimitCache:         newOverLimitCache(),
+			}
+			if coalesced {
+				p.coalescer = newHitsCoalescer(defaultFlushInterval, p.reportHits)
+				p.coalescer.start()
+			}
+			ctx := metadata.NewIncomingContext(
+				context.Background(),
+				metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+			)
+			traces := testutil.NewTestTraces(testutil.NewTestSpan(), testutil.NewTestSpan())
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = p.ConsumeTraces(ctx, traces)
+				}
+			})
+			b.StopTimer()
+			if coalesced {
+				p.coalescer.shutdown()
+			}
+			b.ReportMetric(float64(client.calls.Load())/float64(b.N), "rpcs/op")
+		})
+	}
+}
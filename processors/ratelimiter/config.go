@@ -1,14 +1,39 @@
 package ratelimiter
 
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/config/configgrpc"
+)
+
 // Config defines config for ratelimit processor.
-// The processor calls rate limit service for group of spans.
+// The processor calls rate limit service for group of spans, data points or log records.
 // The processor either drops or forwards data based on rate limit response.
 // The tenant ID header is obtained from the context object.
 // The processor run immediately after tenantId processor
 type Config struct {
+	// Mode defines where rate limit decisions are taken, rls or local, or shadow which
+	// takes rls decisions but only records them. Default rls.
+	Mode Mode `mapstructure:"mode"`
+	// ClientConfig defines the gRPC connection to the rate limit service: endpoint, TLS,
+	// auth, keepalive, compression and balancer. The endpoint may resolve to several
+	// replicas, e.g. dns:///ratelimit:8081, calls are balanced round robin by default.
+	// Plaintext by default, TLS requires tls insecure: false.
+	configgrpc.ClientConfig `mapstructure:",squash"`
 	// ServiceHost defines host where rate limiter service is running default "localhost".
+	// Only used when Endpoint is not set.
+	//
+	// Deprecated: use Endpoint.
 	ServiceHost string `mapstructure:"service_host"`
 	// ServicePort defines port where rate limiter service is running. Default 8081.
+	// Only used when Endpoint is not set.
+	//
+	// Deprecated: use Endpoint.
 	ServicePort uint16 `mapstructure:"service_port"`
 	//Domain  rate limit configuration domain to query. Default collector
 	Domain string `mapstructure:"domain"`
@@ -16,4 +41,346 @@ type Config struct {
 	TenantIDHeaderName string `mapstructure:"tenant_id_header_name"`
 	// Timeout in millis for grpc call.
 	TimeoutMillis uint32 `mapstructure:"timeout_millis"`
+	// Local defines the per tenant token buckets used in local mode.
+	Local LocalConfig `mapstructure:"local"`
+	// FailureMode defines what happens to data when the rate limit service call
+	// fails or the circuit breaker is open. Default open.
+	FailureMode FailureMode `mapstructure:"failure_mode"`
+	// LastDecisionMaxAge defines how long a decision is applied by the last_decision
+	// failure mode, older decisions are forgotten. Default 5m.
+	LastDecisionMaxAge time.Duration `mapstructure:"last_decision_max_age"`
+	// CircuitBreaker stops calling the rate limit service after consecutive failures.
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	// Descriptors defines the descriptors spans are rate limited by in rls mode. Spans
+	// are grouped by the values of every descriptor, each group is limited on its own
+	// span count and only the spans of over limit groups are dropped. Every group takes
+	// a rate limit service call, up to 8 calls of a batch are made concurrently. When
+	// empty, all spans of a batch are limited by a single tenant_spans descriptor of the
+	// tenant ID.
+	// Metrics and logs are always limited by their tenant descriptor.
+	Descriptors []DescriptorConfig `mapstructure:"descriptors"`
+	// MaxDescriptorGroups bounds the descriptor groups of a batch and so its rate limit
+	// service calls. Spans that would start a group past it are limited by the
+	// tenant_spans descriptor of the tenant ID instead. Default 100.
+	MaxDescriptorGroups int `mapstructure:"max_descriptor_groups"`
+	// HitsUnit defines what requests are charged by, count of spans, data points and
+	// log records or bytes of their marshaled proto size. In local mode the buckets
+	// hold bytes then. Default count.
+	HitsUnit HitsUnit `mapstructure:"hits_unit"`
+	// RejectOverLimit returns a RESOURCE_EXHAUSTED error to the receiver for dropped
+	// data instead of reporting success, which OTLP/HTTP answers with 429. Default false.
+	RejectOverLimit bool `mapstructure:"reject_over_limit"`
+	// Shadow defines the shadow mode.
+	Shadow ShadowConfig `mapstructure:"shadow"`
+	// Coalescing reports the hits to the rate limit service in the background instead
+	// of calling it for every request. When not set, every request waits for a call.
+	Coalescing *CoalescingConfig `mapstructure:"coalescing"`
+	// Shedding keeps part of the spans of over limit batches instead of dropping them
+	// all. When not set, the whole batch is dropped.
+	Shedding *SheddingConfig `mapstructure:"shedding"`
+}
+
+// CoalescingConfig defines how hits are coalesced. The hits of a descriptor are
+// summed over the flush interval and reported in a single call. Requests are
+// allowed unless the last report found the descriptor over limit, which is then
+// applied until the limit resets, or until the next report when the service
+// doesn't tell when it resets. Limits may be exceeded by up to an interval of hits.
+type CoalescingConfig struct {
+	// FlushInterval defines how often the hits are reported. Default 100ms.
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+// ShadowConfig defines the shadow mode.
+type ShadowConfig struct {
+	// LogInterval logs a tenant that would have been limited at most once per interval.
+	// Default 0, which disables logs.
+	LogInterval time.Duration `mapstructure:"log_interval"`
+}
+
+// SheddingConfig defines which spans are kept when a tenant is over limit.
+// A span is kept when it matches a priority rule or its trace is sampled.
+type SheddingConfig struct {
+	// KeepErrors keeps spans with status code error.
+	KeepErrors bool `mapstructure:"keep_errors"`
+	// KeepServerSpans keeps spans of kind server.
+	KeepServerSpans bool `mapstructure:"keep_server_spans"`
+	// KeepAttributes keeps spans having one of the attributes.
+	KeepAttributes []AttributeMatchConfig `mapstructure:"keep_attributes"`
+	// SamplingPercentage keeps the other spans of this percentage of the traces, by
+	// trace ID, so kept traces stay complete across batches. Default 0.
+	SamplingPercentage float64 `mapstructure:"sampling_percentage"`
+}
+
+// AttributeMatchConfig matches a span attribute.
+type AttributeMatchConfig struct {
+	// Key is the attribute key.
+	Key string `mapstructure:"key"`
+	// Value is the attribute value, any value matches when empty.
+	Value string `mapstructure:"value"`
+}
+
+// HitsUnit is what requests are charged by.
+type HitsUnit string
+
+const (
+	// HitsUnitCount charges the number of spans, data points or log records.
+	HitsUnitCount HitsUnit = "count"
+	// HitsUnitBytes charges the marshaled proto size.
+	HitsUnitBytes HitsUnit = "bytes"
+)
+
+// DescriptorConfig is a template of a rate limit descriptor.
+type DescriptorConfig struct {
+	// Entries defines the ordered descriptor entries. A span without a value for
+	// one of the entries is not limited by the descriptor.
+	Entries []DescriptorEntryConfig `mapstructure:"entries"`
+}
+
+// DescriptorEntryConfig defines a descriptor entry and where its value comes from.
+type DescriptorEntryConfig struct {
+	// Key is the entry key the rate limit service configuration matches on.
+	Key string `mapstructure:"key"`
+	// Source is where the entry value is taken from.
+	Source DescriptorEntrySource `mapstructure:"source"`
+	// Attribute is the attribute key for the resource_attribute and span_attribute sources.
+	Attribute string `mapstructure:"attribute"`
+}
+
+// DescriptorEntrySource is where a descriptor entry value is taken from.
+type DescriptorEntrySource string
+
+const (
+	// DescriptorEntrySourceTenant uses the tenant ID.
+	DescriptorEntrySourceTenant DescriptorEntrySource = "tenant"
+	// DescriptorEntrySourceResourceAttribute uses a resource attribute, e.g. service.name.
+	DescriptorEntrySourceResourceAttribute DescriptorEntrySource = "resource_attribute"
+	// DescriptorEntrySourceSpanAttribute uses a span attribute.
+	DescriptorEntrySourceSpanAttribute DescriptorEntrySource = "span_attribute"
+	// DescriptorEntrySourceSpanName uses the span name.
+	DescriptorEntrySourceSpanName DescriptorEntrySource = "span_name"
+)
+
+// FailureMode is how data is handled when the rate limit service is not available.
+type FailureMode string
+
+const (
+	// FailureModeOpen forwards the data.
+	FailureModeOpen FailureMode = "open"
+	// FailureModeClosed drops the data.
+	FailureModeClosed FailureMode = "closed"
+	// FailureModeLastDecision applies the last decision the rate limit service
+	// took for the tenant, data of tenants without recent decision is forwarded.
+	FailureModeLastDecision FailureMode = "last_decision"
+)
+
+// CircuitBreakerConfig defines when the rate limit service is considered unavailable.
+// While the breaker is open, the FailureMode applies without calling the service
+// and a single call probes the service every ProbeInterval.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed calls that opens the breaker.
+	// Default 0, which disables the breaker.
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// ProbeInterval defines how often the service is probed while the breaker is open. Default 10s.
+	ProbeInterval time.Duration `mapstructure:"probe_interval"`
+}
+
+// Mode is where rate limit decisions are taken.
+type Mode string
+
+const (
+	// ModeRLS calls the Envoy rate limit service at ServiceHost:ServicePort.
+	ModeRLS Mode = "rls"
+	// ModeLocal uses in process token buckets defined in Local.
+	ModeLocal Mode = "local"
+	// ModeShadow calls the rate limit service like ModeRLS and records the data that
+	// would have been dropped, but always forwards it.
+	ModeShadow Mode = "shadow"
+)
+
+// LocalConfig defines the token buckets of the local mode.
+// A batch is dropped when the bucket of its tenant doesn't hold a token
+// for every span of the batch. A batch larger than the bucket is forwarded
+// when the bucket is full and the tokens it is missing are taken from the
+// next refills. In metrics and logs pipelines the buckets
+// count data points and log records instead, every pipeline has its own buckets.
+type LocalConfig struct {
+	// Tenants defines a bucket per tenant ID.
+	Tenants map[string]BucketConfig `mapstructure:"tenants"`
+	// TenantsFile is a YAML or JSON file of tenant ID to bucket. Its buckets take
+	// precedence over Tenants.
+	TenantsFile string `mapstructure:"tenants_file"`
+	// ReloadInterval defines how often TenantsFile is checked for changes. Default 30s.
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+	// Default defines the bucket of tenants that are not listed. When not set,
+	// unlisted tenants are not rate limited.
+	Default *BucketConfig `mapstructure:"default"`
+}
+
+// BucketConfig defines a token bucket.
+type BucketConfig struct {
+	// SpansPerSecond is the rate the bucket is refilled at.
+	SpansPerSecond float64 `mapstructure:"spans_per_second" yaml:"spans_per_second"`
+	// Burst is the size of the bucket. Default SpansPerSecond rounded up. Batches
+	// larger than it wait for a full bucket, so it should fit the usual batch size.
+	Burst int `mapstructure:"burst" yaml:"burst"`
+}
+
+func (cfg *Config) Validate() error {
+	var errs error
+	switch cfg.Mode {
+	case "", ModeRLS, ModeShadow:
+		errs = errors.Join(errs, cfg.validateEndpoint())
+	case ModeLocal:
+		errs = errors.Join(errs, cfg.Local.validate())
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown mode %q", cfg.Mode))
+	}
+	if len(cfg.Descriptors) > 0 && cfg.Mode == ModeLocal {
+		errs = errors.Join(errs, errors.New("descriptors are not supported in local mode"))
+	}
+	for i, descriptor := range cfg.Descriptors {
+		if err := descriptor.validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("descriptors[%d]: %w", i, err))
+		}
+	}
+	if cfg.MaxDescriptorGroups < 0 {
+		errs = errors.Join(errs, errors.New("max_descriptor_groups must not be negative"))
+	}
+	switch cfg.HitsUnit {
+	case "", HitsUnitCount, HitsUnitBytes:
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown hits_unit %q", cfg.HitsUnit))
+	}
+	switch cfg.FailureMode {
+	case "", FailureModeOpen, FailureModeClosed, FailureModeLastDecision:
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown failure_mode %q", cfg.FailureMode))
+	}
+	if cfg.Shedding != nil {
+		if err := cfg.Shedding.validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("shedding: %w", err))
+		}
+	}
+	if cfg.Coalescing != nil {
+		if cfg.Mode == ModeLocal {
+			errs = errors.Join(errs, errors.New("coalescing is not supported in local mode"))
+		}
+		if cfg.Coalescing.FlushInterval < 0 {
+			errs = errors.Join(errs, errors.New("coalescing: flush_interval must not be negative"))
+		}
+	}
+	if cfg.Shadow.LogInterval < 0 {
+		errs = errors.Join(errs, errors.New("shadow: log_interval must not be negative"))
+	}
+	if cfg.LastDecisionMaxAge < 0 {
+		errs = errors.Join(errs, errors.New("last_decision_max_age must not be negative"))
+	}
+	if cfg.CircuitBreaker.FailureThreshold < 0 {
+		errs = errors.Join(errs, errors.New("circuit_breaker: failure_threshold must not be negative"))
+	}
+	if cfg.CircuitBreaker.ProbeInterval < 0 {
+		errs = errors.Join(errs, errors.New("circuit_breaker: probe_interval must not be negative"))
+	}
+	return errs
+}
+
+// endpoint returns the rate limit service target, from ServiceHost and ServicePort
+// when Endpoint is not set.
+func (cfg *Config) endpoint() string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return net.JoinHostPort(cfg.ServiceHost, strconv.Itoa(int(cfg.ServicePort)))
+}
+
+func (cfg *Config) validateEndpoint() error {
+	if cfg.Endpoint == "" {
+		var errs error
+		if cfg.ServiceHost == "" {
+			errs = errors.Join(errs, errors.New("endpoint or service_host must be set"))
+		}
+		if cfg.ServicePort == 0 {
+			errs = errors.Join(errs, errors.New("service_port must not be 0"))
+		}
+		return errs
+	}
+	if strings.HasPrefix(cfg.Endpoint, "unix:") {
+		return nil
+	}
+	// Strip the scheme and authority of targets like dns:///host:port.
+	target := cfg.Endpoint[strings.LastIndex(cfg.Endpoint, "/")+1:]
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", cfg.Endpoint, err)
+	}
+	if host == "" {
+		return fmt.Errorf("invalid endpoint %q: host must not be empty", cfg.Endpoint)
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return fmt.Errorf("invalid endpoint %q: invalid port %q", cfg.Endpoint, port)
+	}
+	return nil
+}
+
+func (cfg DescriptorConfig) validate() error {
+	if len(cfg.Entries) == 0 {
+		return errors.New("entries must not be empty")
+	}
+	var errs error
+	for i, entry := range cfg.Entries {
+		if entry.Key == "" {
+			errs = errors.Join(errs, fmt.Errorf("entries[%d]: key must not be empty", i))
+		}
+		switch entry.Source {
+		case DescriptorEntrySourceTenant, DescriptorEntrySourceSpanName:
+		case DescriptorEntrySourceResourceAttribute, DescriptorEntrySourceSpanAttribute:
+			if entry.Attribute == "" {
+				errs = errors.Join(errs, fmt.Errorf("entries[%d]: attribute is required for source %s", i, entry.Source))
+			}
+		default:
+			errs = errors.Join(errs, fmt.Errorf("entries[%d]: unknown source %q", i, entry.Source))
+		}
+	}
+	return errs
+}
+
+func (cfg SheddingConfig) validate() error {
+	var errs error
+	if cfg.SamplingPercentage < 0 || cfg.SamplingPercentage > 100 {
+		errs = errors.Join(errs, errors.New("sampling_percentage must be between 0 and 100"))
+	}
+	for i, attr := range cfg.KeepAttributes {
+		if attr.Key == "" {
+			errs = errors.Join(errs, fmt.Errorf("keep_attributes[%d]: key must not be empty", i))
+		}
+	}
+	return errs
+}
+
+func (cfg LocalConfig) validate() error {
+	var errs error
+	if len(cfg.Tenants) == 0 && cfg.TenantsFile == "" && cfg.Default == nil {
+		errs = errors.Join(errs, errors.New("local mode requires tenants, tenants_file or default"))
+	}
+	for tenantID, bucket := range cfg.Tenants {
+		if err := bucket.validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("tenants[%s]: %w", tenantID, err))
+		}
+	}
+	if cfg.Default != nil {
+		if err := cfg.Default.validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("default: %w", err))
+		}
+	}
+	return errs
+}
+
+func (cfg BucketConfig) validate() error {
+	if cfg.SpansPerSecond <= 0 {
+		return errors.New("spans_per_second must be positive")
+	}
+	if cfg.Burst < 0 {
+		return errors.New("burst must not be negative")
+	}
+	return nil
 }
@@ -3,10 +3,13 @@ package ratelimiter
 import (
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configcompression"
+	"go.opentelemetry.io/collector/config/configopaque"
 	"go.opentelemetry.io/collector/otelcol/otelcoltest"
 )
 
@@ -27,4 +30,271 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, "localhost", tIDcfg.ServiceHost)
 	assert.Equal(t, uint16(8081), tIDcfg.ServicePort)
 	assert.Equal(t, uint32(10), tIDcfg.TimeoutMillis)
+	assert.Equal(t, FailureModeLastDecision, tIDcfg.FailureMode)
+	assert.Equal(t, time.Minute, tIDcfg.LastDecisionMaxAge)
+	assert.True(t, tIDcfg.RejectOverLimit)
+	assert.Equal(t, HitsUnitBytes, tIDcfg.HitsUnit)
+	assert.Equal(t, &CoalescingConfig{FlushInterval: 50 * time.Millisecond}, tIDcfg.Coalescing)
+	assert.Equal(t, &SheddingConfig{
+		KeepErrors:         true,
+		KeepServerSpans:    true,
+		KeepAttributes:     []AttributeMatchConfig{{Key: "priority", Value: "high"}},
+		SamplingPercentage: 10,
+	}, tIDcfg.Shedding)
+	assert.Equal(t, []DescriptorConfig{
+		{Entries: []DescriptorEntryConfig{
+			{Key: "tenant_spans", Source: DescriptorEntrySourceTenant},
+			{Key: "service", Source: DescriptorEntrySourceResourceAttribute, Attribute: "service.name"},
+		}},
+		{Entries: []DescriptorEntryConfig{
+			{Key: "service", Source: DescriptorEntrySourceResourceAttribute, Attribute: "service.name"},
+			{Key: "span_name", Source: DescriptorEntrySourceSpanName},
+		}},
+	}, tIDcfg.Descriptors)
+	assert.Equal(t, 50, tIDcfg.MaxDescriptorGroups)
+	assert.Equal(t, CircuitBreakerConfig{FailureThreshold: 5, ProbeInterval: 30 * time.Second}, tIDcfg.CircuitBreaker)
+}
+
+func TestLoadConfigLocal(t *testing.T) {
+	factories, err := otelcoltest.NopFactories()
+	assert.NoError(t, err)
+
+	factories.Processors[Type] = NewFactory()
+
+	cfg, err := otelcoltest.LoadConfig(path.Join(".", "testdata", "config.yml"), factories)
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	rlCfg := cfg.Processors[component.NewIDWithName(Type, "local")].(*Config)
+	assert.Equal(t, ModeLocal, rlCfg.Mode)
+	assert.Equal(t, LocalConfig{
+		Tenants:        map[string]BucketConfig{"tenant1": {SpansPerSecond: 100, Burst: 200}},
+		TenantsFile:    "testdata/tenants.yml",
+		ReloadInterval: 10 * time.Second,
+		Default:        &BucketConfig{SpansPerSecond: 10},
+	}, rlCfg.Local)
+}
+
+func TestLoadConfigGRPC(t *testing.T) {
+	factories, err := otelcoltest.NopFactories()
+	assert.NoError(t, err)
+
+	factories.Processors[Type] = NewFactory()
+
+	cfg, err := otelcoltest.LoadConfig(path.Join(".", "testdata", "config.yml"), factories)
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	rlCfg := cfg.Processors[component.NewIDWithName(Type, "grpc")].(*Config)
+	assert.Equal(t, "dns:///ratelimit.svc:8081", rlCfg.endpoint())
+	assert.False(t, rlCfg.TLSSetting.Insecure)
+	assert.Equal(t, "ca.pem", rlCfg.TLSSetting.CAFile)
+	assert.Equal(t, map[string]configopaque.String{"x-api-key": "secret"}, rlCfg.Headers)
+	assert.Equal(t, configcompression.TypeGzip, rlCfg.Compression)
+	assert.Equal(t, 30*time.Second, rlCfg.Keepalive.Time)
+	assert.Equal(t, "round_robin", rlCfg.BalancerName)
+}
+
+func TestLoadConfigShadow(t *testing.T) {
+	factories, err := otelcoltest.NopFactories()
+	assert.NoError(t, err)
+
+	factories.Processors[Type] = NewFactory()
+
+	cfg, err := otelcoltest.LoadConfig(path.Join(".", "testdata", "config.yml"), factories)
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	rlCfg := cfg.Processors[component.NewIDWithName(Type, "shadow")].(*Config)
+	assert.Equal(t, ModeShadow, rlCfg.Mode)
+	assert.Equal(t, ShadowConfig{LogInterval: time.Minute}, rlCfg.Shadow)
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{
+			name: "rls",
+			cfg:  Config{Mode: ModeRLS},
+		},
+		{
+			name:    "unknown hits unit",
+			cfg:     Config{HitsUnit: "kilobytes"},
+			wantErr: `unknown hits_unit "kilobytes"`,
+		},
+		{
+			name: "shedding",
+			cfg:  Config{Shedding: &SheddingConfig{KeepErrors: true, SamplingPercentage: 10}},
+		},
+		{
+			name: "invalid shedding",
+			cfg: Config{Shedding: &SheddingConfig{
+				KeepAttributes:     []AttributeMatchConfig{{Value: "high"}},
+				SamplingPercentage: 101,
+			}},
+			wantErr: "shedding: sampling_percentage must be between 0 and 100\nkeep_attributes[0]: key must not be empty",
+		},
+		{
+			name: "shadow",
+			cfg:  Config{Mode: ModeShadow, Descriptors: testDescriptors, Shadow: ShadowConfig{LogInterval: time.Minute}},
+		},
+		{
+			name:    "negative shadow log interval",
+			cfg:     Config{Mode: ModeShadow, Shadow: ShadowConfig{LogInterval: -time.Minute}},
+			wantErr: "shadow: log_interval must not be negative",
+		},
+		{
+			name: "coalescing",
+			cfg:  Config{Coalescing: &CoalescingConfig{FlushInterval: time.Second}},
+		},
+		{
+			name:    "invalid coalescing",
+			cfg:     Config{Mode: ModeLocal, Local: LocalConfig{Default: &BucketConfig{SpansPerSecond: 1}}, Coalescing: &CoalescingConfig{FlushInterval: -time.Second}},
+			wantErr: "coalescing is not supported in local mode\ncoalescing: flush_interval must not be negative",
+		},
+		{
+			name:    "unknown failure mode",
+			cfg:     Config{FailureMode: "half"},
+			wantErr: `unknown failure_mode "half"`,
+		},
+		{
+			name:    "negative last decision max age",
+			cfg:     Config{FailureMode: FailureModeLastDecision, LastDecisionMaxAge: -time.Minute},
+			wantErr: "last_decision_max_age must not be negative",
+		},
+		{
+			name:    "negative max descriptor groups",
+			cfg:     Config{MaxDescriptorGroups: -1},
+			wantErr: "max_descriptor_groups must not be negative",
+		},
+		{
+			name:    "negative failure threshold",
+			cfg:     Config{CircuitBreaker: CircuitBreakerConfig{FailureThreshold: -1}},
+			wantErr: "circuit_breaker: failure_threshold must not be negative",
+		},
+		{
+			name: "descriptors",
+			cfg: Config{Descriptors: []DescriptorConfig{{Entries: []DescriptorEntryConfig{
+				{Key: "tenant_spans", Source: DescriptorEntrySourceTenant},
+				{Key: "http_route", Source: DescriptorEntrySourceSpanAttribute, Attribute: "http.route"},
+			}}}},
+		},
+		{
+			name:    "descriptor without entries",
+			cfg:     Config{Descriptors: []DescriptorConfig{{}}},
+			wantErr: "descriptors[0]: entries must not be empty",
+		},
+		{
+			name: "invalid descriptor entries",
+			cfg: Config{Descriptors: []DescriptorConfig{{Entries: []DescriptorEntryConfig{
+				{Source: DescriptorEntrySourceTenant},
+				{Key: "service", Source: DescriptorEntrySourceResourceAttribute},
+				{Key: "host", Source: "header"},
+			}}}},
+			wantErr: "descriptors[0]: entries[0]: key must not be empty\n" +
+				"entries[1]: attribute is required for source resource_attribute\n" +
+				`entries[2]: unknown source "header"`,
+		},
+		{
+			name: "descriptors in local mode",
+			cfg: Config{Mode: ModeLocal, Local: LocalConfig{Default: &BucketConfig{SpansPerSecond: 1}}, Descriptors: []DescriptorConfig{{Entries: []DescriptorEntryConfig{
+				{Key: "tenant_spans", Source: DescriptorEntrySourceTenant},
+			}}}},
+			wantErr: "descriptors are not supported in local mode",
+		},
+		{
+			name:    "unknown mode",
+			cfg:     Config{Mode: "remote"},
+			wantErr: `unknown mode "remote"`,
+		},
+		{
+			name:    "local without buckets",
+			cfg:     Config{Mode: ModeLocal},
+			wantErr: "local mode requires tenants, tenants_file or default",
+		},
+		{
+			name: "local with default",
+			cfg:  Config{Mode: ModeLocal, Local: LocalConfig{Default: &BucketConfig{SpansPerSecond: 1}}},
+		},
+		{
+			name:    "local with invalid tenant bucket",
+			cfg:     Config{Mode: ModeLocal, Local: LocalConfig{Tenants: map[string]BucketConfig{"tenant1": {}}}},
+			wantErr: "tenants[tenant1]: spans_per_second must be positive",
+		},
+		{
+			name:    "local with invalid default bucket",
+			cfg:     Config{Mode: ModeLocal, Local: LocalConfig{Default: &BucketConfig{SpansPerSecond: 1, Burst: -1}}},
+			wantErr: "default: burst must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The endpoint is covered by TestValidateEndpoint.
+			tt.cfg.Endpoint = "localhost:8081"
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		endpoint    string
+		serviceHost string
+		servicePort uint16
+		wantErr     string
+	}{
+		{name: "host and port", endpoint: "ratelimit:8081"},
+		{name: "dns round robin", endpoint: "dns:///ratelimit.svc:8081"},
+		{name: "unix socket", endpoint: "unix:///var/run/ratelimit.sock"},
+		{name: "service host and port", serviceHost: "ratelimit", servicePort: 8081},
+		{
+			name:     "missing port",
+			endpoint: "ratelimit",
+			wantErr:  `invalid endpoint "ratelimit": address ratelimit: missing port in address`,
+		},
+		{
+			name:     "missing host",
+			endpoint: "dns:///:8081",
+			wantErr:  `invalid endpoint "dns:///:8081": host must not be empty`,
+		},
+		{
+			name:     "invalid port",
+			endpoint: "ratelimit:http",
+			wantErr:  `invalid endpoint "ratelimit:http": invalid port "http"`,
+		},
+		{
+			name:     "port out of range",
+			endpoint: "ratelimit:70000",
+			wantErr:  `invalid endpoint "ratelimit:70000": invalid port "70000"`,
+		},
+		{
+			name:    "missing service host and port",
+			wantErr: "endpoint or service_host must be set\nservice_port must not be 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{ServiceHost: tt.serviceHost, ServicePort: tt.servicePort}
+			cfg.Endpoint = tt.endpoint
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	cfg := Config{ServiceHost: "ratelimit", ServicePort: 8081}
+	assert.Equal(t, "ratelimit:8081", cfg.endpoint())
+	cfg.Endpoint = "dns:///ratelimit:9091"
+	assert.Equal(t, "dns:///ratelimit:9091", cfg.endpoint())
 }
@@ -0,0 +1,270 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	pb_struct "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// spanGroup is a descriptor of the spans sharing its entry values.
+type spanGroup struct {
+	// descriptor is the index of the descriptor the group is of, the number of
+	// descriptors for the tenant_spans group of the spans past the group limit.
+	descriptor int
+	entries    []*pb_struct.RateLimitDescriptor_Entry
+	// hits is the span count or the bytes of the spans, depending on the hits unit.
+	hits int
+}
+
+// maxConcurrentDescriptorCalls bounds the rate limit decisions of the descriptor
+// groups of a batch that are made at once.
+const maxConcurrentDescriptorCalls = 8
+
+// defaultMaxDescriptorGroups bounds the descriptor groups of a batch, their
+// number depends on the data.
+const defaultMaxDescriptorGroups = 100
+
+// consumeTracesByDescriptors limits every descriptor group of the batch on its own
+// and drops the spans of over limit groups.
+func (p *rateLimiterProcessor) consumeTracesByDescriptors(ctx context.Context, traces ptrace.Traces) error {
+	tenantId, err := p.getTenantId(ctx)
+	if err != nil {
+		// If tenantId is missing, rate limiting not applicable.
+		p.logger.Error("unable to extract tenantId ", zap.Error(err))
+		return p.nextConsumer.ConsumeTraces(ctx, traces)
+	}
+	tenantAttr := metric.WithAttributes(attribute.KeyValue{
+		Key:   attribute.Key(tagTenantID),
+		Value: attribute.StringValue(tenantId),
+	})
+
+	hitsOf := func(ptrace.Span) int { return 1 }
+	if p.hitsUnit == HitsUnitBytes {
+		hitsOf = newSpanSizer()
+	}
+	maxGroups := p.maxDescriptorGroups
+	if maxGroups <= 0 {
+		maxGroups = defaultMaxDescriptorGroups
+	}
+	groups, spanGroups := groupSpans(p.descriptors, maxGroups, tenantId, traces, hitsOf)
+	overLimitGroups := make([]bool, len(groups))
+	untilResets := make([]time.Duration, len(groups))
+	// The data decides how many groups there are, so the calls are made
+	// concurrently instead of one after another.
+	forEachConcurrently(len(groups), maxConcurrentDescriptorCalls, func(i int) {
+		group := groups[i]
+		overLimitGroups[i], untilResets[i] = p.shouldRateLimit(ctx, tenantAttr, group.entries, toHitsAddend(group.hits))
+		if overLimitGroups[i] {
+			p.logger.Debug(fmt.Sprintf("descriptor %s of tenant %s exceeded rate limit, of hits: %d", decisionKey(group.entries), tenantId, group.hits))
+		}
+	})
+	anyOverLimit := false
+	var retryAfter time.Duration
+	for i, overLimit := range overLimitGroups {
+		if overLimit {
+			anyOverLimit = true
+			retryAfter = max(retryAfter, untilResets[i])
+		}
+	}
+	if !anyOverLimit {
+		return p.nextConsumer.ConsumeTraces(ctx, traces)
+	}
+	if p.shadow {
+		// The spans are counted per descriptor, the values of the groups come from
+		// the data and are not used as labels.
+		descriptorSpanCounts := make([]int, len(p.descriptors)+1)
+		for _, memberOf := range spanGroups {
+			for _, group := range memberOf {
+				if overLimitGroups[group] {
+					descriptorSpanCounts[groups[group].descriptor]++
+				}
+			}
+		}
+		for i, count := range descriptorSpanCounts {
+			if count == 0 {
+				continue
+			}
+			name := TenantSpans
+			if i < len(p.descriptors) {
+				name = descriptorName(p.descriptors[i])
+			}
+			p.recordShadowDrop(ctx, tenantId, name, count)
+		}
+		return p.nextConsumer.ConsumeTraces(ctx, traces)
+	}
+
+	spanCount := traces.SpanCount()
+	size := tracesMarshaler.TracesSize(traces)
+	spanIndex := 0
+	traces.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				drop := false
+				for _, group := range spanGroups[spanIndex] {
+					if overLimitGroups[group] {
+						drop = true
+						break
+					}
+				}
+				spanIndex++
+				return drop && (p.shedder == nil || !p.shedder.keep(span))
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+	dropped := spanCount - traces.SpanCount()
+	droppedBytes := size - tracesMarshaler.TracesSize(traces)
+	p.logger.Warn(fmt.Sprintf("dropping spans for tenant %s as rate limit exceeded, of spancount: %d, bytes: %d", tenantId, dropped, droppedBytes))
+	p.telemetryBuilder.ProcessorDroppedSpanCount.Add(ctx, int64(dropped), tenantAttr)
+	p.telemetryBuilder.ProcessorDroppedBytes.Add(ctx, int64(droppedBytes), metric.WithAttributes(
+		attribute.String(tagTenantID, tenantId),
+		attribute.String(tagSignal, signalTraces),
+	))
+	return p.forwardLeft(dropped, spanCount, retryAfter, func() error {
+		return p.nextConsumer.ConsumeTraces(ctx, traces)
+	})
+}
+
+// forEachConcurrently calls fn for every index below n, from up to limit
+// goroutines, and returns when all calls returned.
+func forEachConcurrently(n, limit int, fn func(i int)) {
+	if n == 1 {
+		fn(0)
+		return
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(n, limit); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// groupSpans returns the descriptor groups of the spans, charged hitsOf every
+// span, and the indexes of the groups of every span, in iteration order. Spans
+// that would start a group past maxGroups are put in a single group of the
+// tenant_spans descriptor of the tenant.
+func groupSpans(descriptors []DescriptorConfig, maxGroups int, tenantId string, traces ptrace.Traces, hitsOf func(ptrace.Span) int) ([]*spanGroup, [][]int) {
+	var groups []*spanGroup
+	groupIndexes := map[string]int{}
+	overflowGroup := -1
+	spanGroups := make([][]int, 0, traces.SpanCount())
+
+	rss := traces.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		resourceAttrs := rs.Resource().Attributes()
+		sss := rs.ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				var memberOf []int
+				hits := 0
+				for d, descriptor := range descriptors {
+					entries, ok := descriptorEntries(descriptor, tenantId, resourceAttrs, span)
+					if !ok {
+						continue
+					}
+					key := decisionKey(entries)
+					index, ok := groupIndexes[key]
+					if !ok && len(groupIndexes) >= maxGroups {
+						if overflowGroup < 0 {
+							overflowGroup = len(groups)
+							groups = append(groups, &spanGroup{
+								descriptor: len(descriptors),
+								entries:    []*pb_struct.RateLimitDescriptor_Entry{{Key: TenantSpans, Value: tenantId}},
+							})
+						}
+						if slices.Contains(memberOf, overflowGroup) {
+							continue
+						}
+						index = overflowGroup
+					} else if !ok {
+						index = len(groups)
+						groupIndexes[key] = index
+						groups = append(groups, &spanGroup{descriptor: d, entries: entries})
+					}
+					if memberOf == nil {
+						hits = hitsOf(span)
+					}
+					groups[index].hits += hits
+					memberOf = append(memberOf, index)
+				}
+				spanGroups = append(spanGroups, memberOf)
+			}
+		}
+	}
+	return groups, spanGroups
+}
+
+// descriptorName names a descriptor after its entry keys, e.g. tenant_spans,service.
+// Unlike the decision key, it doesn't depend on the data.
+func descriptorName(descriptor DescriptorConfig) string {
+	keys := make([]string, len(descriptor.Entries))
+	for i, entry := range descriptor.Entries {
+		keys[i] = entry.Key
+	}
+	return strings.Join(keys, ",")
+}
+
+// newSpanSizer returns a func computing the marshaled proto size a span adds
+// to a batch of its own, the resource and scope aren't charged.
+func newSpanSizer() func(ptrace.Span) int {
+	scratch := ptrace.NewTraces()
+	scratchSpan := scratch.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	envelopeSize := tracesMarshaler.TracesSize(scratch)
+	return func(span ptrace.Span) int {
+		span.CopyTo(scratchSpan)
+		return tracesMarshaler.TracesSize(scratch) - envelopeSize
+	}
+}
+
+// descriptorEntries returns the entries of the descriptor for a span, false
+// when a value is missing.
+func descriptorEntries(descriptor DescriptorConfig, tenantId string, resourceAttrs pcommon.Map, span ptrace.Span) ([]*pb_struct.RateLimitDescriptor_Entry, bool) {
+	entries := make([]*pb_struct.RateLimitDescriptor_Entry, len(descriptor.Entries))
+	for i, entry := range descriptor.Entries {
+		var value string
+		switch entry.Source {
+		case DescriptorEntrySourceTenant:
+			value = tenantId
+		case DescriptorEntrySourceResourceAttribute:
+			if v, ok := resourceAttrs.Get(entry.Attribute); ok {
+				value = v.AsString()
+			}
+		case DescriptorEntrySourceSpanAttribute:
+			if v, ok := span.Attributes().Get(entry.Attribute); ok {
+				value = v.AsString()
+			}
+		case DescriptorEntrySourceSpanName:
+			value = span.Name()
+		}
+		if value == "" {
+			return nil, false
+		}
+		entries[i] = &pb_struct.RateLimitDescriptor_Entry{Key: entry.Key, Value: value}
+	}
+	return entries, true
+}
@@ -0,0 +1,329 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb_struct "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	internalmetadata "github.com/hypertrace/collector/processors/ratelimiter/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testDescriptors = []DescriptorConfig{
+	{Entries: []DescriptorEntryConfig{
+		{Key: "tenant_spans", Source: DescriptorEntrySourceTenant},
+		{Key: "service", Source: DescriptorEntrySourceResourceAttribute, Attribute: "service.name"},
+	}},
+	{Entries: []DescriptorEntryConfig{
+		{Key: "service", Source: DescriptorEntrySourceResourceAttribute, Attribute: "service.name"},
+		{Key: "span_name", Source: DescriptorEntrySourceSpanName},
+	}},
+}
+
+// newDescriptorTestTraces returns 2 spans of service1, GET /a and GET /b, 3 spans
+// of service2, GET /a, and a span without service.
+func newDescriptorTestTraces() ptrace.Traces {
+	traces := ptrace.NewTraces()
+	for _, service := range []struct {
+		name  string
+		spans []string
+	}{
+		{name: "service1", spans: []string{"GET /a", "GET /b"}},
+		{name: "service2", spans: []string{"GET /a", "GET /a", "GET /a"}},
+		{spans: []string{"GET /c"}},
+	} {
+		rs := traces.ResourceSpans().AppendEmpty()
+		if service.name != "" {
+			rs.Resource().Attributes().PutStr("service.name", service.name)
+		}
+		spans := rs.ScopeSpans().AppendEmpty().Spans()
+		for _, name := range service.spans {
+			spans.AppendEmpty().SetName(name)
+		}
+	}
+	return traces
+}
+
+func TestGroupSpans(t *testing.T) {
+	groups, spanGroups := groupSpans(testDescriptors, defaultMaxDescriptorGroups, testTenantID, newDescriptorTestTraces(), func(ptrace.Span) int { return 1 })
+
+	var keys []string
+	var hits []int
+	for _, group := range groups {
+		keys = append(keys, decisionKey(group.entries))
+		hits = append(hits, group.hits)
+	}
+	assert.Equal(t, []string{
+		"tenant_spans/jdoe,service/service1",
+		"service/service1,span_name/GET \\/a",
+		"service/service1,span_name/GET \\/b",
+		"tenant_spans/jdoe,service/service2",
+		"service/service2,span_name/GET \\/a",
+	}, keys)
+	assert.Equal(t, []int{2, 1, 1, 3, 3}, hits)
+	assert.Equal(t, [][]int{{0, 1}, {0, 2}, {3, 4}, {3, 4}, {3, 4}, nil}, spanGroups)
+}
+
+func TestGroupSpansMaxGroups(t *testing.T) {
+	groups, spanGroups := groupSpans(testDescriptors, 2, testTenantID, newDescriptorTestTraces(), func(ptrace.Span) int { return 1 })
+
+	var keys []string
+	var hits []int
+	for _, group := range groups {
+		keys = append(keys, decisionKey(group.entries))
+		hits = append(hits, group.hits)
+	}
+	// The spans past the 2 groups are limited by the tenant, once per span.
+	assert.Equal(t, []string{
+		"tenant_spans/jdoe,service/service1",
+		"service/service1,span_name/GET \\/a",
+		"tenant_spans/jdoe",
+	}, keys)
+	assert.Equal(t, []int{2, 1, 4}, hits)
+	assert.Equal(t, [][]int{{0, 1}, {0, 2}, {2}, {2}, {2}, nil}, spanGroups)
+	assert.Equal(t, len(testDescriptors), groups[2].descriptor)
+}
+
+func TestGroupSpansBytes(t *testing.T) {
+	spanSize := newSpanSizer()
+	traces := newDescriptorTestTraces()
+	groups, _ := groupSpans(testDescriptors[:1], defaultMaxDescriptorGroups, testTenantID, traces, spanSize)
+
+	require.Len(t, groups, 2)
+	spans := traces.ResourceSpans().At(1).ScopeSpans().At(0).Spans()
+	assert.Equal(t, spanSize(spans.At(0))+spanSize(spans.At(1))+spanSize(spans.At(2)), groups[1].hits)
+}
+
+func TestNewSpanSizer(t *testing.T) {
+	spanSize := newSpanSizer()
+	span := ptrace.NewSpan()
+	span.SetName("GET /a")
+	small := spanSize(span)
+	assert.Positive(t, small)
+	span.Attributes().PutStr("http.url", "http://localhost/a")
+	assert.Greater(t, spanSize(span), small)
+	// The scratch span is overwritten by every call.
+	span.Attributes().Clear()
+	assert.Equal(t, small, spanSize(span))
+}
+
+func TestRateLimitingByDescriptors(t *testing.T) {
+	tests := []struct {
+		name          string
+		overLimitKeys []string
+		reject        bool
+		shedding      *SheddingConfig
+		wantSpanNames []string
+	}{
+		{
+			name:          "nothing over limit",
+			wantSpanNames: []string{"GET /a", "GET /b", "GET /a", "GET /a", "GET /a", "GET /c"},
+		},
+		{
+			name:          "service over limit",
+			overLimitKeys: []string{"tenant_spans/jdoe,service/service2"},
+			wantSpanNames: []string{"GET /a", "GET /b", "GET /c"},
+		},
+		{
+			name:          "span name over limit",
+			overLimitKeys: []string{"service/service1,span_name/GET \\/b"},
+			reject:        true,
+			wantSpanNames: []string{"GET /a", "GET /a", "GET /a", "GET /a", "GET /c"},
+		},
+		{
+			name:          "priority spans of over limit service kept",
+			overLimitKeys: []string{"tenant_spans/jdoe,service/service1"},
+			shedding:      &SheddingConfig{KeepAttributes: []AttributeMatchConfig{{Key: "priority"}}},
+			wantSpanNames: []string{"GET /b", "GET /a", "GET /a", "GET /a", "GET /c"},
+		},
+		{
+			name:          "all services over limit",
+			overLimitKeys: []string{"service/service1,span_name/GET \\/a", "service/service1,span_name/GET \\/b", "service/service2,span_name/GET \\/a"},
+			reject:        true,
+			wantSpanNames: []string{"GET /c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+			tracesSink := new(consumertest.TracesSink)
+			telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+			require.NoError(t, err)
+			p := &rateLimiterProcessor{
+				logger:                     zap.NewNop(),
+				tenantIDHeaderName:         defaultHeaderName,
+				domain:                     defaultDomain,
+				rateLimitServiceClient:     mockRateLimitServiceClientObj,
+				rateLimitServiceClientConn: &grpc.ClientConn{},
+				nextConsumer:               tracesSink,
+				telemetryBuilder:           telemetryBuilder,
+				descriptors:                testDescriptors,
+				rejectOverLimit:            tt.reject,
+				shedder:                    newShedder(tt.shedding),
+			}
+			mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.MatchedBy(func(req *pb.RateLimitRequest) bool {
+				return slices.Contains(tt.overLimitKeys, decisionKey(req.Descriptors[0].Entries))
+			})).Return(&pb.RateLimitResponse{
+				OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+				Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OVER_LIMIT}},
+			}, nil)
+			mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(&pb.RateLimitResponse{
+				OverallCode: pb.RateLimitResponse_OK,
+				Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OK}},
+			}, nil)
+			ctx := metadata.NewIncomingContext(
+				context.Background(),
+				metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+			)
+
+			traces := newDescriptorTestTraces()
+			traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(1).Attributes().PutStr("priority", "high")
+			require.NoError(t, p.ConsumeTraces(ctx, traces))
+			mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 5)
+			require.Len(t, tracesSink.AllTraces(), 1)
+			var spanNames []string
+			rss := tracesSink.AllTraces()[0].ResourceSpans()
+			for i := 0; i < rss.Len(); i++ {
+				spans := rss.At(i).ScopeSpans().At(0).Spans()
+				assert.Positive(t, spans.Len())
+				for j := 0; j < spans.Len(); j++ {
+					spanNames = append(spanNames, spans.At(j).Name())
+				}
+			}
+			assert.Equal(t, tt.wantSpanNames, spanNames)
+		})
+	}
+}
+
+func TestRateLimitingByDescriptorsWholeBatchDropped(t *testing.T) {
+	mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+	tracesSink := new(consumertest.TracesSink)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:                     zap.NewNop(),
+		tenantIDHeaderName:         defaultHeaderName,
+		domain:                     defaultDomain,
+		rateLimitServiceClient:     mockRateLimitServiceClientObj,
+		rateLimitServiceClientConn: &grpc.ClientConn{},
+		nextConsumer:               tracesSink,
+		telemetryBuilder:           telemetryBuilder,
+		descriptors:                testDescriptors[:1],
+		rejectOverLimit:            true,
+	}
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(&pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+		Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OVER_LIMIT}},
+	}, nil)
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+	)
+	traces := newDescriptorTestTraces()
+	// Spans without service are not limited by the descriptor.
+	traces.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		_, ok := rs.Resource().Attributes().Get("service.name")
+		return !ok
+	})
+
+	err = p.ConsumeTraces(ctx, traces)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 2)
+	assert.Empty(t, tracesSink.AllTraces())
+}
+
+func TestRateLimitingByDescriptorsManyGroups(t *testing.T) {
+	mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+	tracesSink := new(consumertest.TracesSink)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:                     zap.NewNop(),
+		tenantIDHeaderName:         defaultHeaderName,
+		domain:                     defaultDomain,
+		rateLimitServiceClient:     mockRateLimitServiceClientObj,
+		rateLimitServiceClientConn: &grpc.ClientConn{},
+		nextConsumer:               tracesSink,
+		telemetryBuilder:           telemetryBuilder,
+		descriptors:                testDescriptors[1:],
+	}
+	var inFlight, maxInFlight atomic.Int32
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.MatchedBy(func(req *pb.RateLimitRequest) bool {
+		return req.Descriptors[0].Entries[1].Value == "GET /0"
+	})).Return(&pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+		Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OVER_LIMIT}},
+	}, nil)
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+		n := inFlight.Add(1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		inFlight.Add(-1)
+	}).Return(&pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OK,
+		Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OK}},
+	}, nil)
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+	)
+
+	const groupCount = 50
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "service1")
+	spans := rs.ScopeSpans().AppendEmpty().Spans()
+	for i := 0; i < groupCount; i++ {
+		spans.AppendEmpty().SetName(fmt.Sprintf("GET /%d", i))
+	}
+
+	require.NoError(t, p.ConsumeTraces(ctx, traces))
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", groupCount)
+	assert.Greater(t, maxInFlight.Load(), int32(1))
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(maxConcurrentDescriptorCalls))
+	require.Len(t, tracesSink.AllTraces(), 1)
+	assert.Equal(t, groupCount-1, tracesSink.AllTraces()[0].SpanCount())
+}
+
+func TestDecisionKey(t *testing.T) {
+	entry := func(key, value string) *pb_struct.RateLimitDescriptor_Entry {
+		return &pb_struct.RateLimitDescriptor_Entry{Key: key, Value: value}
+	}
+	assert.Equal(t, "tenant/t1,span_name/GET \\/a\\,b", decisionKey([]*pb_struct.RateLimitDescriptor_Entry{
+		entry("tenant", "t1"), entry("span_name", "GET /a,b"),
+	}))
+
+	// Keys which would collide without escaping.
+	assert.NotEqual(t,
+		decisionKey([]*pb_struct.RateLimitDescriptor_Entry{entry("a", "b,c/d")}),
+		decisionKey([]*pb_struct.RateLimitDescriptor_Entry{entry("a", "b"), entry("c", "d")}),
+	)
+	assert.NotEqual(t,
+		decisionKey([]*pb_struct.RateLimitDescriptor_Entry{entry("a/b", "c")}),
+		decisionKey([]*pb_struct.RateLimitDescriptor_Entry{entry("a", "b/c")}),
+	)
+	assert.NotEqual(t,
+		decisionKey([]*pb_struct.RateLimitDescriptor_Entry{entry("a", `b\`), entry("c", "d")}),
+		decisionKey([]*pb_struct.RateLimitDescriptor_Entry{entry("a", `b\,c/d`)}),
+	)
+}
@@ -2,18 +2,15 @@ package ratelimiter
 
 import (
 	"context"
-	"net"
-	"strconv"
 	"time"
 
-	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
 	"github.com/hypertrace/collector/processors/ratelimiter/internal/metadata"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/processor"
 	"go.uber.org/zap"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 const (
@@ -34,6 +31,8 @@ func NewFactory() processor.Factory {
 		Type,
 		createDefaultConfig,
 		processor.WithTraces(createTraceProcessor, component.StabilityLevelStable),
+		processor.WithMetrics(createMetricsProcessor, metadata.MetricsStability),
+		processor.WithLogs(createLogsProcessor, metadata.LogsStability),
 	)
 }
 
@@ -41,9 +40,17 @@ func createDefaultConfig() component.Config {
 	return &Config{
 		ServiceHost:        defaultServiceHost,
 		ServicePort:        defaultServicePort,
+		Mode:               ModeRLS,
 		Domain:             defaultDomain,
+		FailureMode:        FailureModeOpen,
+		HitsUnit:           HitsUnitCount,
 		TenantIDHeaderName: defaultHeaderName,
-		TimeoutMillis:      defaultTimeoutMillis,
+		ClientConfig: configgrpc.ClientConfig{
+			TLSSetting:   configtls.ClientConfig{Insecure: true},
+			Keepalive:    configgrpc.NewDefaultKeepaliveClientConfig(),
+			BalancerName: configgrpc.BalancerName(),
+		},
+		TimeoutMillis: defaultTimeoutMillis,
 	}
 }
 
@@ -53,43 +60,85 @@ func createTraceProcessor(
 	cfg component.Config,
 	nextConsumer consumer.Traces,
 ) (processor.Traces, error) {
-	pCfg := cfg.(*Config)
-	rateLimitServiceClient, rateLimitServiceClientConn, cancelFunc, err := getRateLimitServiceClient(ctx, pCfg.ServiceHost, pCfg.ServicePort, pCfg.TimeoutMillis, params)
+	rateLimiter, err := newRateLimiterProcessor(ctx, params, cfg.(*Config))
 	if err != nil {
-		params.Logger.Error("failed to connect to rate limit service ", zap.Error(err))
 		return nil, err
 	}
-	// TelemetryBuilder will be used to setup metrics
-	telemetryBuilder, err := metadata.NewTelemetryBuilder(params.TelemetrySettings)
+	rateLimiter.nextConsumer = nextConsumer
+	return rateLimiter, nil
+}
+
+func createMetricsProcessor(
+	ctx context.Context,
+	params processor.Settings,
+	cfg component.Config,
+	nextConsumer consumer.Metrics,
+) (processor.Metrics, error) {
+	rateLimiter, err := newRateLimiterProcessor(ctx, params, cfg.(*Config))
 	if err != nil {
-		params.Logger.Error("error creating telemetry for the ratelimiter processor", zap.Error(err))
 		return nil, err
 	}
-	rateLimiter := &rateLimiterProcessor{
-		rateLimitServiceClient:     rateLimitServiceClient,
-		domain:                     pCfg.Domain,
-		logger:                     params.Logger,
-		tenantIDHeaderName:         pCfg.TenantIDHeaderName,
-		nextConsumer:               nextConsumer,
-		rateLimitServiceClientConn: rateLimitServiceClientConn,
-		cancelFunc:                 cancelFunc,
-		telemetryBuilder:           telemetryBuilder,
+	rateLimiter.nextMetricsConsumer = nextConsumer
+	return rateLimiter, nil
+}
+
+func createLogsProcessor(
+	ctx context.Context,
+	params processor.Settings,
+	cfg component.Config,
+	nextConsumer consumer.Logs,
+) (processor.Logs, error) {
+	rateLimiter, err := newRateLimiterProcessor(ctx, params, cfg.(*Config))
+	if err != nil {
+		return nil, err
 	}
+	rateLimiter.nextLogsConsumer = nextConsumer
 	return rateLimiter, nil
 }
 
-func getRateLimitServiceClient(ctx context.Context, serviceHost string, servicePort uint16,
-	timeoutMillis uint32, params processor.Settings) (pb.RateLimitServiceClient, *grpc.ClientConn, context.CancelFunc, error) {
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(timeoutMillis))
-	var err error
-	var conn *grpc.ClientConn
-	dialString := net.JoinHostPort(serviceHost, strconv.Itoa(int(servicePort)))
-	params.Logger.Info("connecting to rate limit service %s " + dialString)
-	conn, err = grpc.DialContext(ctxWithTimeout, dialString, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func newRateLimiterProcessor(_ context.Context, params processor.Settings, pCfg *Config) (*rateLimiterProcessor, error) {
+	// TelemetryBuilder will be used to setup metrics
+	telemetryBuilder, err := metadata.NewTelemetryBuilder(params.TelemetrySettings)
 	if err != nil {
-		params.Logger.Error("Unable to connect to rate limit service", zap.Error(err))
-		cancel()
-		return nil, nil, nil, err
+		params.Logger.Error("error creating telemetry for the ratelimiter processor", zap.Error(err))
+		return nil, err
+	}
+	if pCfg.Mode == ModeLocal {
+		return &rateLimiterProcessor{
+			logger:             params.Logger,
+			tenantIDHeaderName: pCfg.TenantIDHeaderName,
+			telemetryBuilder:   telemetryBuilder,
+			localRateLimiter:   newLocalRateLimiter(pCfg.Local, params.Logger),
+			rejectOverLimit:    pCfg.RejectOverLimit,
+			hitsUnit:           pCfg.HitsUnit,
+			shedder:            newShedder(pCfg.Shedding),
+		}, nil
+	}
+	// The connection is created on start, auth extensions are not available before.
+	clientConfig := pCfg.ClientConfig
+	clientConfig.Endpoint = pCfg.endpoint()
+	rateLimiter := &rateLimiterProcessor{
+		clientConfig:        &clientConfig,
+		telemetrySettings:   params.TelemetrySettings,
+		domain:              pCfg.Domain,
+		logger:              params.Logger,
+		tenantIDHeaderName:  pCfg.TenantIDHeaderName,
+		telemetryBuilder:    telemetryBuilder,
+		timeout:             time.Millisecond * time.Duration(pCfg.TimeoutMillis),
+		failureMode:         pCfg.FailureMode,
+		lastDecisions:       lastDecisions{maxAge: pCfg.LastDecisionMaxAge},
+		overLimitCache:      newOverLimitCache(),
+		rejectOverLimit:     pCfg.RejectOverLimit,
+		descriptors:         pCfg.Descriptors,
+		maxDescriptorGroups: pCfg.MaxDescriptorGroups,
+		hitsUnit:            pCfg.HitsUnit,
+		shedder:             newShedder(pCfg.Shedding),
+		shadow:              pCfg.Mode == ModeShadow,
+		shadowLogger:        newShadowLogger(pCfg.Shadow.LogInterval, params.Logger),
+	}
+	rateLimiter.circuitBreaker = newCircuitBreaker(pCfg.CircuitBreaker, rateLimiter.onCircuitBreakerStateChange)
+	if pCfg.Coalescing != nil {
+		rateLimiter.coalescer = newHitsCoalescer(pCfg.Coalescing.FlushInterval, rateLimiter.reportHits)
 	}
-	return pb.NewRateLimitServiceClient(conn), conn, cancel, nil
+	return rateLimiter, nil
 }
@@ -1,16 +1,60 @@
 package ratelimiter
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/processor/processortest"
 )
 
 func TestCreateDefaultConfig(t *testing.T) {
 	cfg := createDefaultConfig().(*Config)
+	assert.Equal(t, ModeRLS, cfg.Mode)
+	assert.Equal(t, FailureModeOpen, cfg.FailureMode)
+	assert.Equal(t, HitsUnitCount, cfg.HitsUnit)
 	assert.Equal(t, defaultHeaderName, cfg.TenantIDHeaderName)
 	assert.Equal(t, defaultServiceHost, cfg.ServiceHost)
 	assert.Equal(t, defaultServicePort, cfg.ServicePort)
 	assert.Equal(t, defaultDomain, cfg.Domain)
 	assert.Equal(t, defaultTimeoutMillis, cfg.TimeoutMillis)
+	assert.True(t, cfg.TLSSetting.Insecure)
+	assert.Equal(t, "round_robin", cfg.BalancerName)
+}
+
+func TestCreateProcessorRLSMode(t *testing.T) {
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.Endpoint = "dns:///ratelimit.svc:8081"
+
+	tp, err := factory.CreateTracesProcessor(context.Background(), processortest.NewNopSettings(), cfg, consumertest.NewNop())
+	require.NoError(t, err)
+	// The connection is established lazily, the service doesn't need to be up.
+	require.NoError(t, tp.Start(context.Background(), componenttest.NewNopHost()))
+	assert.NotNil(t, tp.(*rateLimiterProcessor).rateLimitServiceClient)
+	require.NoError(t, tp.Shutdown(context.Background()))
+}
+
+func TestCreateProcessorsLocalMode(t *testing.T) {
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.Mode = ModeLocal
+	cfg.Local.Default = &BucketConfig{SpansPerSecond: 10}
+	params := processortest.NewNopSettings()
+
+	tp, err := factory.CreateTracesProcessor(context.Background(), params, cfg, consumertest.NewNop())
+	require.NoError(t, err)
+	mp, err := factory.CreateMetricsProcessor(context.Background(), params, cfg, consumertest.NewNop())
+	require.NoError(t, err)
+	lp, err := factory.CreateLogsProcessor(context.Background(), params, cfg, consumertest.NewNop())
+	require.NoError(t, err)
+
+	for _, p := range []component.Component{tp, mp, lp} {
+		require.NoError(t, p.Start(context.Background(), componenttest.NewNopHost()))
+		require.NoError(t, p.Shutdown(context.Background()))
+	}
 }
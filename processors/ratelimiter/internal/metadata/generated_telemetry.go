@@ -31,7 +31,14 @@ type TelemetryBuilder struct {
 	// In generated code but unused
 	// meter                               metric.Meter
 	ProcessorDroppedSpanCount           metric.Int64Counter
+	ProcessorDroppedDataPointCount      metric.Int64Counter
+	ProcessorDroppedLogRecordCount      metric.Int64Counter
+	ProcessorDroppedBytes               metric.Int64Counter
 	ProcessorRateLimitServiceCallsCount metric.Int64Counter
+	ProcessorCircuitBreakerState        metric.Int64Gauge
+	ProcessorOverLimitCacheHits         metric.Int64Counter
+	ProcessorOverLimitCacheMisses       metric.Int64Counter
+	ProcessorShadowDroppedCount         metric.Int64Counter
 	meters                              map[configtelemetry.Level]metric.Meter
 }
 
@@ -63,11 +70,53 @@ func NewTelemetryBuilder(settings component.TelemetrySettings, options ...Teleme
 		metric.WithUnit("{spans}"),
 	)
 	errs = errors.Join(errs, err)
+	builder.ProcessorDroppedDataPointCount, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_dropped_datapoint_count",
+		metric.WithDescription("Number of metric data points dropped per tenant due to rate limiting"),
+		metric.WithUnit("{datapoints}"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorDroppedLogRecordCount, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_dropped_log_record_count",
+		metric.WithDescription("Number of log records dropped per tenant due to rate limiting"),
+		metric.WithUnit("{records}"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorDroppedBytes, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_dropped_bytes",
+		metric.WithDescription("Marshaled proto size of the data dropped per tenant and signal due to rate limiting"),
+		metric.WithUnit("By"),
+	)
+	errs = errors.Join(errs, err)
 	builder.ProcessorRateLimitServiceCallsCount, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
 		"otelcol_tenant_id_rate_limit_service_calls_count",
 		metric.WithDescription("Number of calls to rate limiter service from collector"),
 		metric.WithUnit("{spans}"),
 	)
 	errs = errors.Join(errs, err)
+	builder.ProcessorCircuitBreakerState, err = builder.meters[configtelemetry.LevelBasic].Int64Gauge(
+		"otelcol_tenant_id_rate_limit_service_circuit_breaker_state",
+		metric.WithDescription("State of the rate limit service circuit breaker, 0 closed and 1 open"),
+		metric.WithUnit("1"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorOverLimitCacheHits, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_over_limit_cache_hit_count",
+		metric.WithDescription("Number of over limit decisions served from the cache without calling the rate limit service"),
+		metric.WithUnit("{requests}"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorOverLimitCacheMisses, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_over_limit_cache_miss_count",
+		metric.WithDescription("Number of requests without cached over limit decision"),
+		metric.WithUnit("{requests}"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorShadowDroppedCount, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_shadow_dropped_count",
+		metric.WithDescription("Number of spans, data points or log records per tenant and descriptor that would have been dropped in shadow mode"),
+		metric.WithUnit("{items}"),
+	)
+	errs = errors.Join(errs, err)
 	return &builder, errs
 }
@@ -0,0 +1,84 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultLastDecisionMaxAge = 5 * time.Minute
+	// lastDecisionsMaxEntries bounds the stored keys, descriptor values come from the data.
+	lastDecisionsMaxEntries = 10000
+)
+
+// lastDecisions holds whether the last rate limit service call per decision key
+// was over limit, for FailureModeLastDecision. Decisions older than maxAge are
+// not applied and removed. The zero value is ready to use.
+type lastDecisions struct {
+	// maxAge defaults to defaultLastDecisionMaxAge.
+	maxAge time.Duration
+	// now defaults to time.Now.
+	now func() time.Time
+
+	mu        sync.Mutex
+	decisions map[string]lastDecision
+	lastSweep time.Time
+}
+
+type lastDecision struct {
+	overLimit bool
+	at        time.Time
+}
+
+func (d *lastDecisions) age() time.Duration {
+	if d.maxAge > 0 {
+		return d.maxAge
+	}
+	return defaultLastDecisionMaxAge
+}
+
+func (d *lastDecisions) currentTime() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+// store records the decision of key. Expired decisions are removed every max age,
+// or when full. Decisions of new keys are not stored while it stays full.
+func (d *lastDecisions) store(key string, overLimit bool) {
+	now := d.currentTime()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.decisions == nil {
+		d.decisions = map[string]lastDecision{}
+	}
+	if _, ok := d.decisions[key]; !ok && (len(d.decisions) >= lastDecisionsMaxEntries || now.Sub(d.lastSweep) >= d.age()) {
+		d.lastSweep = now
+		for k, decision := range d.decisions {
+			if now.Sub(decision.at) > d.age() {
+				delete(d.decisions, k)
+			}
+		}
+		if len(d.decisions) >= lastDecisionsMaxEntries {
+			return
+		}
+	}
+	d.decisions[key] = lastDecision{overLimit: overLimit, at: now}
+}
+
+// load returns the decision of key, false when there is none younger than max age.
+func (d *lastDecisions) load(key string) (bool, bool) {
+	now := d.currentTime()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	decision, ok := d.decisions[key]
+	if !ok {
+		return false, false
+	}
+	if now.Sub(decision.at) > d.age() {
+		delete(d.decisions, key)
+		return false, false
+	}
+	return decision.overLimit, true
+}
@@ -0,0 +1,51 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastDecisions(t *testing.T) {
+	var d lastDecisions
+	now := time.Unix(0, 0)
+	d.now = func() time.Time { return now }
+	d.maxAge = time.Minute
+
+	_, ok := d.load("tenant_spans/tenant1")
+	assert.False(t, ok)
+	d.store("tenant_spans/tenant1", true)
+	d.store("tenant_spans/tenant2", false)
+	overLimit, ok := d.load("tenant_spans/tenant1")
+	assert.True(t, ok)
+	assert.True(t, overLimit)
+	overLimit, ok = d.load("tenant_spans/tenant2")
+	assert.True(t, ok)
+	assert.False(t, overLimit)
+
+	// Old decisions are not applied.
+	now = now.Add(time.Minute + time.Second)
+	_, ok = d.load("tenant_spans/tenant1")
+	assert.False(t, ok)
+	assert.NotContains(t, d.decisions, "tenant_spans/tenant1")
+
+	// Storing a decision removes the expired ones that are never loaded again.
+	d.store("tenant_spans/tenant3", true)
+	assert.Len(t, d.decisions, 1)
+	assert.Contains(t, d.decisions, "tenant_spans/tenant3")
+}
+
+func TestLastDecisionsMaxEntries(t *testing.T) {
+	var d lastDecisions
+	for i := 0; i < lastDecisionsMaxEntries+10; i++ {
+		d.store(fmt.Sprintf("span_name/%d", i), true)
+	}
+	assert.Len(t, d.decisions, lastDecisionsMaxEntries)
+	// Stored keys are still updated.
+	d.store("span_name/0", false)
+	overLimit, ok := d.load("span_name/0")
+	assert.True(t, ok)
+	assert.False(t, overLimit)
+}
@@ -0,0 +1,168 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hypertrace/collector/processors/internal/filereloader"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultLocalReloadInterval = 30 * time.Second
+	// localLimiterSweepInterval is how often idle tenant limiters are removed.
+	localLimiterSweepInterval = time.Minute
+)
+
+// localRateLimiter keeps a token bucket per tenant in process.
+// Unlisted tenants get their own bucket sized by the default bucket.
+// Limiters of tenants idle long enough for their bucket to be full again
+// are removed, a new limiter starts with a full bucket anyway.
+type localRateLimiter struct {
+	tenants       map[string]BucketConfig
+	fileTenants   atomic.Pointer[map[string]BucketConfig]
+	defaultBucket *BucketConfig
+	reloader      *filereloader.Reloader
+	now           func() time.Time
+
+	mu        sync.Mutex
+	limiters  map[string]*tenantLimiter
+	lastSweep time.Time
+}
+
+type tenantLimiter struct {
+	bucket  BucketConfig
+	limiter *rate.Limiter
+}
+
+func newLocalRateLimiter(cfg LocalConfig, logger *zap.Logger) *localRateLimiter {
+	l := &localRateLimiter{
+		tenants:       cfg.Tenants,
+		defaultBucket: cfg.Default,
+		limiters:      map[string]*tenantLimiter{},
+		now:           time.Now,
+	}
+	if cfg.TenantsFile != "" {
+		reloadInterval := cfg.ReloadInterval
+		if reloadInterval == 0 {
+			reloadInterval = defaultLocalReloadInterval
+		}
+		l.reloader = filereloader.New(cfg.TenantsFile, reloadInterval, l.loadTenants, logger)
+	}
+	return l
+}
+
+func (l *localRateLimiter) start() error {
+	if l.reloader != nil {
+		return l.reloader.Start()
+	}
+	return nil
+}
+
+func (l *localRateLimiter) shutdown() {
+	if l.reloader != nil {
+		l.reloader.Shutdown()
+	}
+}
+
+// allow takes n tokens from the bucket of the tenant and reports whether
+// there were enough of them, otherwise how long until there are. A batch
+// larger than the bucket is allowed when the bucket is full and leaves it
+// short of the tokens it went over by, so the tenant still gets no more
+// than its rate. Tenants without a bucket are always allowed.
+func (l *localRateLimiter) allow(tenantID string, n int) (bool, time.Duration) {
+	bucket, ok := l.bucket(tenantID)
+	if !ok {
+		return true, 0
+	}
+
+	now := l.now()
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) >= localLimiterSweepInterval {
+		l.removeIdleLimiters(now)
+	}
+	tl, ok := l.limiters[tenantID]
+	if !ok {
+		tl = &tenantLimiter{bucket: bucket, limiter: rate.NewLimiter(rate.Limit(bucket.SpansPerSecond), bucket.burst())}
+		l.limiters[tenantID] = tl
+	} else if tl.bucket != bucket {
+		// The bucket was reconfigured, keep the tokens left and apply the new limits.
+		tl.limiter.SetLimitAt(now, rate.Limit(bucket.SpansPerSecond))
+		tl.limiter.SetBurstAt(now, bucket.burst())
+		tl.bucket = bucket
+	}
+	l.mu.Unlock()
+
+	if tl.limiter.AllowN(now, n) {
+		return true, 0
+	}
+	missing := float64(n) - tl.limiter.TokensAt(now)
+	if burst := tl.limiter.Burst(); n > burst {
+		if tl.limiter.TokensAt(now) >= float64(burst) {
+			// The limiter reserves at most burst tokens at once, widen it for the batch.
+			tl.limiter.SetBurstAt(now, n)
+			tl.limiter.ReserveN(now, n)
+			tl.limiter.SetBurstAt(now, burst)
+			return true, 0
+		}
+		missing = float64(burst) - tl.limiter.TokensAt(now)
+	}
+	return false, time.Duration(missing / float64(tl.limiter.Limit()) * float64(time.Second))
+}
+
+// removeIdleLimiters removes the limiters with a full bucket, the caller holds the lock.
+func (l *localRateLimiter) removeIdleLimiters(now time.Time) {
+	l.lastSweep = now
+	for tenantID, tl := range l.limiters {
+		if tl.limiter.TokensAt(now) >= float64(tl.limiter.Burst()) {
+			delete(l.limiters, tenantID)
+		}
+	}
+}
+
+func (l *localRateLimiter) bucket(tenantID string) (BucketConfig, bool) {
+	if fileTenants := l.fileTenants.Load(); fileTenants != nil {
+		if bucket, ok := (*fileTenants)[tenantID]; ok {
+			return bucket, true
+		}
+	}
+	if bucket, ok := l.tenants[tenantID]; ok {
+		return bucket, true
+	}
+	if l.defaultBucket != nil {
+		return *l.defaultBucket, true
+	}
+	return BucketConfig{}, false
+}
+
+// loadTenants parses a YAML or JSON object of tenant ID to bucket.
+func (l *localRateLimiter) loadTenants(data []byte) error {
+	tenants := map[string]BucketConfig{}
+	if err := yaml.Unmarshal(data, &tenants); err != nil {
+		return fmt.Errorf("invalid tenant buckets: %w", err)
+	}
+	var errs error
+	for tenantID, bucket := range tenants {
+		if err := bucket.validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", tenantID, err))
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	l.fileTenants.Store(&tenants)
+	return nil
+}
+
+func (cfg BucketConfig) burst() int {
+	if cfg.Burst > 0 {
+		return cfg.Burst
+	}
+	return int(math.Ceil(cfg.SpansPerSecond))
+}
@@ -0,0 +1,183 @@
+package ratelimiter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	internalmetadata "github.com/hypertrace/collector/processors/ratelimiter/internal/metadata"
+	"github.com/hypertrace/collector/processors/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestLocalRateLimiterAllow(t *testing.T) {
+	l := newLocalRateLimiter(LocalConfig{
+		Tenants: map[string]BucketConfig{"tenant1": {SpansPerSecond: 0.001, Burst: 10}},
+		Default: &BucketConfig{SpansPerSecond: 0.001, Burst: 3},
+	}, zap.NewNop())
+	require.NoError(t, l.start())
+	defer l.shutdown()
+
+	assertAllowed(t, l, "tenant1", 6)
+	assertNotAllowed(t, l, "tenant1", 5)
+	assertAllowed(t, l, "tenant1", 4)
+
+	// Unlisted tenants get their own default sized bucket.
+	assertAllowed(t, l, "tenant2", 3)
+	assertNotAllowed(t, l, "tenant2", 1)
+	assertAllowed(t, l, "tenant3", 3)
+	// A batch larger than the bucket is allowed when the bucket is full, and
+	// empties it for longer.
+	assertAllowed(t, l, "tenant4", 4)
+	assertNotAllowed(t, l, "tenant4", 1)
+	assertNotAllowed(t, l, "tenant2", 4)
+}
+
+func TestLocalRateLimiterRetryAfter(t *testing.T) {
+	l := newLocalRateLimiter(LocalConfig{
+		Default: &BucketConfig{SpansPerSecond: 1, Burst: 10},
+	}, zap.NewNop())
+
+	assertAllowed(t, l, "tenant1", 10)
+	allowed, retryAfter := l.allow("tenant1", 4)
+	assert.False(t, allowed)
+	assert.InDelta(t, 4*time.Second, retryAfter, float64(100*time.Millisecond))
+	// A batch larger than the bucket waits for a full bucket.
+	allowed, retryAfter = l.allow("tenant1", 11)
+	assert.False(t, allowed)
+	assert.InDelta(t, 10*time.Second, retryAfter, float64(100*time.Millisecond))
+}
+
+func TestLocalRateLimiterBatchLargerThanBucket(t *testing.T) {
+	l := newLocalRateLimiter(LocalConfig{
+		Default: &BucketConfig{SpansPerSecond: 1, Burst: 10},
+	}, zap.NewNop())
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	assertAllowed(t, l, "tenant1", 25)
+	// The 15 tokens it went over by are taken from the next refills.
+	now = now.Add(20 * time.Second)
+	allowed, retryAfter := l.allow("tenant1", 10)
+	assert.False(t, allowed)
+	assert.Equal(t, 5*time.Second, retryAfter)
+	now = now.Add(5 * time.Second)
+	assertAllowed(t, l, "tenant1", 10)
+}
+
+func TestLocalRateLimiterNoDefault(t *testing.T) {
+	l := newLocalRateLimiter(LocalConfig{
+		Tenants: map[string]BucketConfig{"tenant1": {SpansPerSecond: 0.001, Burst: 1}},
+	}, zap.NewNop())
+
+	assertAllowed(t, l, "tenant1", 1)
+	assertNotAllowed(t, l, "tenant1", 1)
+	assertAllowed(t, l, "tenant2", 1000)
+}
+
+func TestLocalRateLimiterDefaultBurst(t *testing.T) {
+	assert.Equal(t, 3, BucketConfig{SpansPerSecond: 2.5}.burst())
+	assert.Equal(t, 7, BucketConfig{SpansPerSecond: 2.5, Burst: 7}.burst())
+}
+
+func TestLocalRateLimiterTenantsFile(t *testing.T) {
+	tenantsFile := filepath.Join(t.TempDir(), "tenants.yml")
+	require.NoError(t, os.WriteFile(tenantsFile, []byte("tenant1:\n  spans_per_second: 0.001\n  burst: 2\n"), 0o600))
+
+	l := newLocalRateLimiter(LocalConfig{
+		Tenants:        map[string]BucketConfig{"tenant1": {SpansPerSecond: 0.001, Burst: 100}},
+		TenantsFile:    tenantsFile,
+		ReloadInterval: 10 * time.Millisecond,
+	}, zap.NewNop())
+	require.NoError(t, l.start())
+	defer l.shutdown()
+
+	// The file takes precedence over inline buckets.
+	assertAllowed(t, l, "tenant1", 2)
+	assertNotAllowed(t, l, "tenant1", 1)
+
+	require.NoError(t, os.WriteFile(tenantsFile, []byte(`{"tenant1": {"spans_per_second": 0.001, "burst": 50}}`), 0o600))
+	require.NoError(t, os.Chtimes(tenantsFile, time.Now(), time.Now().Add(time.Second)))
+	assert.Eventually(t, func() bool {
+		bucket, _ := l.bucket("tenant1")
+		return bucket.Burst == 50
+	}, time.Second, 10*time.Millisecond)
+	// A larger bucket accepts larger batches once it refilled.
+	assertNotAllowed(t, l, "tenant1", 40)
+}
+
+func TestLocalRateLimiterInvalidTenantsFile(t *testing.T) {
+	tenantsFile := filepath.Join(t.TempDir(), "tenants.yml")
+	require.NoError(t, os.WriteFile(tenantsFile, []byte("tenant1:\n  spans_per_second: 0\n"), 0o600))
+
+	l := newLocalRateLimiter(LocalConfig{TenantsFile: tenantsFile}, zap.NewNop())
+	assert.ErrorContains(t, l.start(), "tenant1: spans_per_second must be positive")
+}
+
+func TestLocalRateLimitingWhenTenantLimitReached(t *testing.T) {
+	mockProcessorConsumerObj := new(MockProcessorConsumer)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:             zap.NewNop(),
+		tenantIDHeaderName: defaultHeaderName,
+		nextConsumer:       mockProcessorConsumerObj,
+		telemetryBuilder:   telemetryBuilder,
+		localRateLimiter: newLocalRateLimiter(LocalConfig{
+			Tenants: map[string]BucketConfig{testTenantID: {SpansPerSecond: 0.001, Burst: 1}},
+		}, zap.NewNop()),
+	}
+	require.NoError(t, p.Start(context.Background(), componenttest.NewNopHost()))
+	mockProcessorConsumerObj.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+	)
+
+	require.NoError(t, p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan())))
+	require.NoError(t, p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan())))
+	mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeTraces", 1)
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func assertAllowed(t *testing.T, l *localRateLimiter, tenantID string, n int) {
+	t.Helper()
+	allowed, _ := l.allow(tenantID, n)
+	assert.True(t, allowed)
+}
+
+func assertNotAllowed(t *testing.T, l *localRateLimiter, tenantID string, n int) {
+	t.Helper()
+	allowed, _ := l.allow(tenantID, n)
+	assert.False(t, allowed)
+}
+
+func TestLocalRateLimiterRemovesIdleLimiters(t *testing.T) {
+	l := newLocalRateLimiter(LocalConfig{
+		Default: &BucketConfig{SpansPerSecond: 1, Burst: 90},
+	}, zap.NewNop())
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	assertAllowed(t, l, "tenant1", 30)
+	assertAllowed(t, l, "tenant2", 90)
+	assert.Len(t, l.limiters, 2)
+
+	// tenant1 has a full bucket again, tenant2 is still missing tokens.
+	now = now.Add(localLimiterSweepInterval)
+	assertAllowed(t, l, "tenant3", 1)
+	assert.Len(t, l.limiters, 2)
+	assert.NotContains(t, l.limiters, "tenant1")
+	assert.Contains(t, l.limiters, "tenant2")
+
+	// A removed limiter starts over with a full bucket.
+	assertAllowed(t, l, "tenant1", 90)
+	assertNotAllowed(t, l, "tenant1", 1)
+}
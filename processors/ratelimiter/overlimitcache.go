@@ -0,0 +1,78 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// overLimitCacheMaxEntries bounds the cached keys, descriptor values come from the data.
+	overLimitCacheMaxEntries = 10000
+	// overLimitCacheSweepInterval is how often adding a key removes the expired ones.
+	overLimitCacheSweepInterval = time.Minute
+)
+
+// overLimitCache remembers tenants the rate limit service reported as over
+// limit until their limit resets, so their data is dropped without a call.
+type overLimitCache struct {
+	now        func() time.Time
+	maxEntries int
+
+	mu        sync.Mutex
+	resetAt   map[string]time.Time
+	lastSweep time.Time
+}
+
+func newOverLimitCache() *overLimitCache {
+	return &overLimitCache{
+		now:        time.Now,
+		maxEntries: overLimitCacheMaxEntries,
+		resetAt:    map[string]time.Time{},
+	}
+}
+
+// untilReset returns how long key stays over limit, zero when it isn't,
+// and removes expired entries.
+func (c *overLimitCache) untilReset(key string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resetAt, ok := c.resetAt[key]
+	if !ok {
+		return 0
+	}
+	untilReset := resetAt.Sub(c.now())
+	if untilReset <= 0 {
+		delete(c.resetAt, key)
+		return 0
+	}
+	return untilReset
+}
+
+// add caches key as over limit for the duration, non positive durations are ignored.
+// Expired keys are removed every sweep interval, or when the cache is full. Keys
+// are not cached while it stays full, their decisions are taken by the service.
+func (c *overLimitCache) add(key string, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.resetAt[key]; !ok && (len(c.resetAt) >= c.maxEntries || now.Sub(c.lastSweep) >= overLimitCacheSweepInterval) {
+		c.sweep(now)
+		if len(c.resetAt) >= c.maxEntries {
+			return
+		}
+	}
+	c.resetAt[key] = now.Add(duration)
+}
+
+// sweep removes the expired keys, the caller holds the lock.
+func (c *overLimitCache) sweep(now time.Time) {
+	c.lastSweep = now
+	for key, resetAt := range c.resetAt {
+		if !resetAt.After(now) {
+			delete(c.resetAt, key)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverLimitCache(t *testing.T) {
+	c := newOverLimitCache()
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+
+	assert.Zero(t, c.untilReset("tenant_spans/tenant1"))
+	c.add("tenant_spans/tenant1", time.Second)
+	c.add("tenant_spans/tenant2", 0)
+	assert.Equal(t, time.Second, c.untilReset("tenant_spans/tenant1"))
+	assert.Zero(t, c.untilReset("tenant_datapoints/tenant1"))
+	assert.Zero(t, c.untilReset("tenant_spans/tenant2"))
+
+	now = now.Add(time.Second / 4)
+	assert.Equal(t, 3*time.Second/4, c.untilReset("tenant_spans/tenant1"))
+	now = now.Add(time.Second)
+	assert.Zero(t, c.untilReset("tenant_spans/tenant1"))
+	assert.Empty(t, c.resetAt)
+}
+
+func TestOverLimitCacheRemovesExpiredKeys(t *testing.T) {
+	c := newOverLimitCache()
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+
+	c.add("span_name/GET \\/a", time.Second)
+	c.add("span_name/GET \\/b", time.Second)
+	c.add("span_name/GET \\/c", 2*overLimitCacheSweepInterval)
+	now = now.Add(overLimitCacheSweepInterval)
+	// The expired keys are never looked up again, adding a key removes them.
+	c.add("span_name/GET \\/d", time.Second)
+	assert.Len(t, c.resetAt, 2)
+	assert.Contains(t, c.resetAt, "span_name/GET \\/c")
+	assert.Contains(t, c.resetAt, "span_name/GET \\/d")
+}
+
+func TestOverLimitCacheMaxEntries(t *testing.T) {
+	c := newOverLimitCache()
+	c.maxEntries = 2
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+
+	c.add("tenant_spans/tenant1", time.Second)
+	c.add("tenant_spans/tenant2", 2*time.Second)
+	c.add("tenant_spans/tenant3", time.Second)
+	assert.Zero(t, c.untilReset("tenant_spans/tenant3"))
+	// Keys already cached are updated when full.
+	c.add("tenant_spans/tenant2", 3*time.Second)
+	assert.Equal(t, 3*time.Second, c.untilReset("tenant_spans/tenant2"))
+
+	// A full cache removes the expired keys before a key is added.
+	now = now.Add(time.Second)
+	c.add("tenant_spans/tenant3", time.Second)
+	assert.Equal(t, time.Second, c.untilReset("tenant_spans/tenant3"))
+	assert.Len(t, c.resetAt, 2)
+}
@@ -3,36 +3,83 @@ package ratelimiter
 import (
 	"context"
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
 	pb_struct "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
 	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/hypertrace/collector/processors/internal/headers"
 	internalmetadata "github.com/hypertrace/collector/processors/ratelimiter/internal/metadata"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componentstatus"
+	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/processor"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
-const tagTenantID string = "tenant-id"
+const (
+	tagTenantID string = "tenant-id"
+	tagSignal   string = "signal"
+
+	signalTraces  = "traces"
+	signalMetrics = "metrics"
+	signalLogs    = "logs"
+)
 
-var _ processor.Traces = (*rateLimiterProcessor)(nil)
+var (
+	_ processor.Traces  = (*rateLimiterProcessor)(nil)
+	_ processor.Metrics = (*rateLimiterProcessor)(nil)
+	_ processor.Logs    = (*rateLimiterProcessor)(nil)
+)
 
-func (p *rateLimiterProcessor) Start(_ context.Context, _ component.Host) error {
+func (p *rateLimiterProcessor) Start(ctx context.Context, host component.Host) error {
+	p.host = host
+	if p.localRateLimiter != nil {
+		return p.localRateLimiter.start()
+	}
+	if p.clientConfig != nil {
+		p.logger.Info("connecting to rate limit service " + p.clientConfig.Endpoint)
+		conn, err := p.clientConfig.ToClientConn(ctx, host, p.telemetrySettings)
+		if err != nil {
+			return fmt.Errorf("unable to connect to rate limit service: %w", err)
+		}
+		p.rateLimitServiceClientConn = conn
+		p.rateLimitServiceClient = pb.NewRateLimitServiceClient(conn)
+	}
+	if p.coalescer != nil {
+		p.coalescer.start()
+	}
 	return nil
 }
 
 func (p *rateLimiterProcessor) Shutdown(_ context.Context) error {
+	if p.localRateLimiter != nil {
+		p.localRateLimiter.shutdown()
+		return nil
+	}
+	if p.coalescer != nil {
+		// Report the pending hits before the connection is closed.
+		p.coalescer.shutdown()
+	}
+	if p.rateLimitServiceClientConn == nil {
+		return nil
+	}
 	err := p.rateLimitServiceClientConn.Close()
 	if err != nil {
 		p.logger.Error("failure while closing rate limit service client connection ", zap.Error(err))
 	}
-	p.cancelFunc()
 	return nil
 }
 
@@ -46,74 +93,353 @@ type rateLimiterProcessor struct {
 	logger                     *zap.Logger
 	tenantIDHeaderName         string
 	nextConsumer               consumer.Traces
+	nextMetricsConsumer        consumer.Metrics
+	nextLogsConsumer           consumer.Logs
 	rateLimitServiceClientConn *grpc.ClientConn
-	cancelFunc                 context.CancelFunc
 	telemetryBuilder           *internalmetadata.TelemetryBuilder
+	// clientConfig is the rate limit service connection created on start.
+	clientConfig      *configgrpc.ClientConfig
+	telemetrySettings component.TelemetrySettings
+	// localRateLimiter takes the decisions instead of the rate limit service in local mode.
+	localRateLimiter *localRateLimiter
+	// timeout bounds every rate limit service call when set.
+	timeout     time.Duration
+	failureMode FailureMode
+	// lastDecisions holds the recent decisions for FailureModeLastDecision.
+	lastDecisions  lastDecisions
+	circuitBreaker *circuitBreaker
+	host           component.Host
+	// overLimitCache drops data of tenants over limit until their limit resets.
+	overLimitCache *overLimitCache
+	// rejectOverLimit returns an error to the receiver for rate limited data.
+	rejectOverLimit bool
+	// descriptors the spans are grouped and limited by instead of the tenant.
+	descriptors []DescriptorConfig
+	// maxDescriptorGroups bounds the descriptor groups of a batch, zero applies
+	// defaultMaxDescriptorGroups.
+	maxDescriptorGroups int
+	// hitsUnit is what a request is charged by, items or bytes.
+	hitsUnit HitsUnit
+	// shedder keeps part of over limit spans, nil drops them all.
+	shedder *shedder
+	// shadow records over limit data instead of dropping it.
+	shadow       bool
+	shadowLogger *shadowLogger
+	// coalescer reports the hits to the rate limit service in the background when set.
+	coalescer *hitsCoalescer
 }
 
 const (
-	TenantSpans = "tenant_spans"
+	TenantSpans      = "tenant_spans"
+	TenantDataPoints = "tenant_datapoints"
+	TenantLogRecords = "tenant_log_records"
 )
 
+var (
+	tracesMarshaler  ptrace.ProtoMarshaler
+	metricsMarshaler pmetric.ProtoMarshaler
+	logsMarshaler    plog.ProtoMarshaler
+)
+
+// batch is the data of a request as seen by the rate limiter.
+type batch struct {
+	signal        string
+	descriptorKey string
+	itemName      string
+	count         int
+	// size returns the marshaled proto size of the data.
+	size         func() int
+	droppedCount metric.Int64Counter
+	// shed removes the items that are not dropped when over limit and returns
+	// the count left, nil drops everything.
+	shed func() int
+}
+
 // ConsumeTraces consume traces and drops the requests if it is rate limited,
 // otherwise calls next consumer
 func (p *rateLimiterProcessor) ConsumeTraces(ctx context.Context, traces ptrace.Traces) error {
+	if len(p.descriptors) > 0 && p.localRateLimiter == nil {
+		return p.consumeTracesByDescriptors(ctx, traces)
+	}
+	b := batch{
+		signal:        signalTraces,
+		descriptorKey: TenantSpans,
+		itemName:      "spans",
+		count:         traces.SpanCount(),
+		size:          func() int { return tracesMarshaler.TracesSize(traces) },
+		droppedCount:  p.telemetryBuilder.ProcessorDroppedSpanCount,
+		shed:          p.tracesShedder(traces),
+	}
+	dropped, retryAfter := p.rateLimit(ctx, b)
+	return p.forwardLeft(dropped, b.count, retryAfter, func() error {
+		return p.nextConsumer.ConsumeTraces(ctx, traces)
+	})
+}
+
+// tracesShedder returns the shed func of the traces, nil without shedding.
+func (p *rateLimiterProcessor) tracesShedder(traces ptrace.Traces) func() int {
+	if p.shedder == nil {
+		return nil
+	}
+	return func() int { return p.shedder.shed(traces) }
+}
+
+// ConsumeMetrics consume metrics and drops the requests if it is rate limited,
+// otherwise calls next consumer
+func (p *rateLimiterProcessor) ConsumeMetrics(ctx context.Context, metrics pmetric.Metrics) error {
+	b := batch{
+		signal:        signalMetrics,
+		descriptorKey: TenantDataPoints,
+		itemName:      "data points",
+		count:         metrics.DataPointCount(),
+		size:          func() int { return metricsMarshaler.MetricsSize(metrics) },
+		droppedCount:  p.telemetryBuilder.ProcessorDroppedDataPointCount,
+	}
+	dropped, retryAfter := p.rateLimit(ctx, b)
+	return p.forwardLeft(dropped, b.count, retryAfter, func() error {
+		return p.nextMetricsConsumer.ConsumeMetrics(ctx, metrics)
+	})
+}
+
+// ConsumeLogs consume logs and drops the requests if it is rate limited,
+// otherwise calls next consumer
+func (p *rateLimiterProcessor) ConsumeLogs(ctx context.Context, logs plog.Logs) error {
+	b := batch{
+		signal:        signalLogs,
+		descriptorKey: TenantLogRecords,
+		itemName:      "log records",
+		count:         logs.LogRecordCount(),
+		size:          func() int { return logsMarshaler.LogsSize(logs) },
+		droppedCount:  p.telemetryBuilder.ProcessorDroppedLogRecordCount,
+	}
+	dropped, retryAfter := p.rateLimit(ctx, b)
+	return p.forwardLeft(dropped, b.count, retryAfter, func() error {
+		return p.nextLogsConsumer.ConsumeLogs(ctx, logs)
+	})
+}
+
+// rateLimit drops the batch when the tenant of the request exceeded its limit
+// for it and returns the count of dropped items, less than the batch count when
+// part of it is left after shedding. The dropped items and bytes are counted.
+// The returned duration is when the request could be retried, zero if unknown.
+// Requests without tenant ID are never limited, failed rate limit service calls
+// are handled by the failure mode.
+func (p *rateLimiterProcessor) rateLimit(ctx context.Context, b batch) (int, time.Duration) {
 	tenantId, err := p.getTenantId(ctx)
 	if err != nil {
 		// If tenantId is missing, rate limiting not applicable.
 		p.logger.Error("unable to extract tenantId ", zap.Error(err))
-		return p.nextConsumer.ConsumeTraces(ctx, traces)
+		return 0, 0
+	}
+	size := -1
+	hits := b.count
+	if p.hitsUnit == HitsUnitBytes {
+		size = b.size()
+		hits = size
 	}
-	desc := make([]*pb_struct.RateLimitDescriptor, 1)
-	desc[0] = &pb_struct.RateLimitDescriptor{
-		Entries: []*pb_struct.RateLimitDescriptor_Entry{
+	tenantAttr := metric.WithAttributes(attribute.KeyValue{
+		Key:   attribute.Key(tagTenantID),
+		Value: attribute.StringValue(tenantId),
+	})
+	var overLimit bool
+	var retryAfter time.Duration
+	if p.localRateLimiter != nil {
+		var allowed bool
+		allowed, retryAfter = p.localRateLimiter.allow(tenantId, hits)
+		overLimit = !allowed
+	} else {
+		overLimit, retryAfter = p.shouldRateLimit(ctx, tenantAttr, []*pb_struct.RateLimitDescriptor_Entry{
 			{
-				Key:   TenantSpans,
+				Key:   b.descriptorKey,
 				Value: tenantId,
 			},
-		},
+		}, toHitsAddend(hits))
+	}
+	if !overLimit {
+		return 0, 0
+	}
+	if p.shadow {
+		p.recordShadowDrop(ctx, tenantId, b.descriptorKey, b.count)
+		return 0, 0
+	}
+	if size < 0 {
+		size = b.size()
+	}
+	dropped, droppedBytes := b.count, size
+	if b.shed != nil {
+		if left := b.shed(); left > 0 {
+			dropped, droppedBytes = b.count-left, size-b.size()
+		}
+	}
+	// If tenant rate limit exceeded drop request.
+	p.logger.Warn(fmt.Sprintf("dropping %s for tenant %s as rate limit exceeded, of count: %d, bytes: %d", b.itemName, tenantId, dropped, droppedBytes))
+	b.droppedCount.Add(ctx, int64(dropped), tenantAttr)
+	p.telemetryBuilder.ProcessorDroppedBytes.Add(ctx, int64(droppedBytes), metric.WithAttributes(
+		attribute.String(tagTenantID, tenantId),
+		attribute.String(tagSignal, b.signal),
+	))
+	return dropped, retryAfter
+}
+
+// forwardLeft forwards what is left of a batch of count items after dropped of
+// them were dropped. Only a fully dropped batch returns the rate limited error,
+// when part of it is forwarded an error would make the client send it again.
+func (p *rateLimiterProcessor) forwardLeft(dropped, count int, retryAfter time.Duration, forward func() error) error {
+	if dropped > 0 && dropped == count {
+		return p.rateLimitedError(retryAfter)
+	}
+	return forward()
+}
+
+// toHitsAddend converts a number of items or bytes to a rate limit request hits addend.
+func toHitsAddend(hits int) uint32 {
+	if hits > math.MaxUint32 {
+		return math.MaxUint32
 	}
 	// G115 (CWE-190): integer overflow conversion int -> uint32 (Confidence: MEDIUM, Severity: HIGH)
 	// This is a false positive we can ignore.
-	spanCount := uint32(traces.SpanCount()) // #nosec G115
-	tenantAttr := metric.WithAttributes(attribute.KeyValue{
-		Key:   attribute.Key(tagTenantID),
-		Value: attribute.StringValue(tenantId),
-	})
+	return uint32(hits) // #nosec G115
+}
+
+// shouldRateLimit reports whether hits of the descriptor are over limit and for how
+// long, zero if unknown. Cached over limit decisions are answered without calling the
+// rate limit service, failed calls are handled by the failure mode. With coalescing,
+// other hits are allowed and reported to the rate limit service later.
+func (p *rateLimiterProcessor) shouldRateLimit(ctx context.Context, tenantAttr metric.MeasurementOption, entries []*pb_struct.RateLimitDescriptor_Entry, hits uint32) (bool, time.Duration) {
+	key := decisionKey(entries)
+	if p.overLimitCache != nil {
+		if untilReset := p.overLimitCache.untilReset(key); untilReset > 0 {
+			p.telemetryBuilder.ProcessorOverLimitCacheHits.Add(ctx, int64(1), tenantAttr)
+			return true, untilReset
+		}
+		p.telemetryBuilder.ProcessorOverLimitCacheMisses.Add(ctx, int64(1), tenantAttr)
+	}
+	if p.coalescer != nil {
+		p.coalescer.add(key, entries, tenantAttr, hits)
+		return false, 0
+	}
+	return p.callRateLimitService(ctx, tenantAttr, key, entries, hits)
+}
+
+// callRateLimitService asks the rate limit service whether hits of the descriptor
+// are over limit, unless the circuit breaker is open.
+func (p *rateLimiterProcessor) callRateLimitService(ctx context.Context, tenantAttr metric.MeasurementOption, key string, entries []*pb_struct.RateLimitDescriptor_Entry, hits uint32) (bool, time.Duration) {
+	if p.circuitBreaker != nil && !p.circuitBreaker.allow() {
+		return p.failureDecision(key)
+	}
+	callCtx := ctx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
 	p.telemetryBuilder.ProcessorRateLimitServiceCallsCount.Add(ctx, int64(1), tenantAttr)
 	response, err := p.rateLimitServiceClient.ShouldRateLimit(
-		ctx,
+		callCtx,
 		&pb.RateLimitRequest{
 			Domain:      p.domain,
-			Descriptors: desc,
-			HitsAddend:  spanCount,
+			Descriptors: []*pb_struct.RateLimitDescriptor{{Entries: entries}},
+			HitsAddend:  hits,
 		})
 	if err != nil {
-		// Rate limit service call fails, spans will be forwarded as it is.
 		p.logger.Error("rate limit service call failed", zap.Error(err))
-		return p.nextConsumer.ConsumeTraces(ctx, traces)
+		if p.circuitBreaker != nil {
+			p.circuitBreaker.failure(err)
+		}
+		return p.failureDecision(key)
+	}
+	if p.circuitBreaker != nil {
+		p.circuitBreaker.success()
 	}
+	overLimit := false
+	var untilReset time.Duration
 	descriptorStatuses := response.Statuses
 	if len(descriptorStatuses) == 1 {
-		if descriptorStatuses[0].GetCode() == pb.RateLimitResponse_OVER_LIMIT {
-			// If tenant rate limit exceeded drop request.
-			p.logger.Warn(fmt.Sprintf("dropping spans for tenant %s as rate limit exceeded, of spancount: %d", tenantId, spanCount))
-			p.telemetryBuilder.ProcessorDroppedSpanCount.Add(ctx, int64(spanCount), tenantAttr)
-			return nil
+		overLimit = descriptorStatuses[0].GetCode() == pb.RateLimitResponse_OVER_LIMIT
+		untilReset = descriptorStatuses[0].GetDurationUntilReset().AsDuration()
+		if overLimit && p.overLimitCache != nil {
+			p.overLimitCache.add(key, untilReset)
 		}
 	} else {
 		p.logger.Error(fmt.Sprintf("unexpected descriptor status length from rate limit response: %s ", descriptorStatuses))
 	}
-	return p.nextConsumer.ConsumeTraces(ctx, traces)
+	if p.failureMode == FailureModeLastDecision {
+		p.lastDecisions.store(key, overLimit)
+	}
+	if !overLimit {
+		return false, 0
+	}
+	return true, untilReset
+}
+
+// failureDecision applies the failure mode when the rate limit service
+// could not be called.
+func (p *rateLimiterProcessor) failureDecision(key string) (bool, time.Duration) {
+	overLimit := false
+	switch p.failureMode {
+	case FailureModeClosed:
+		overLimit = true
+	case FailureModeLastDecision:
+		overLimit, _ = p.lastDecisions.load(key)
+	}
+	if overLimit {
+		p.logger.Warn(fmt.Sprintf("rate limit service is not available, failure mode %s limits descriptor %s", p.failureMode, key))
+	}
+	return overLimit, 0
+}
+
+// rateLimitedError returns nil, which drops the data silently, or a RESOURCE_EXHAUSTED
+// status the OTLP receivers answer with, HTTP 429 for OTLP/HTTP. A known retry delay is
+// attached as RetryInfo detail, which OTLP exporters use to back off.
+func (p *rateLimiterProcessor) rateLimitedError(retryAfter time.Duration) error {
+	if !p.rejectOverLimit {
+		return nil
+	}
+	st := status.New(codes.ResourceExhausted, "tenant rate limit exceeded")
+	if retryAfter > 0 {
+		if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+// onCircuitBreakerStateChange exports the breaker state and reports it as component status.
+func (p *rateLimiterProcessor) onCircuitBreakerStateChange(open bool, err error) {
+	if open {
+		p.logger.Error("rate limit service circuit breaker opened", zap.Error(err))
+		p.telemetryBuilder.ProcessorCircuitBreakerState.Record(context.Background(), 1)
+		componentstatus.ReportStatus(p.host, componentstatus.NewRecoverableErrorEvent(fmt.Errorf("%w: %w", errCircuitBreakerOpen, err)))
+		return
+	}
+	p.logger.Info("rate limit service circuit breaker closed")
+	p.telemetryBuilder.ProcessorCircuitBreakerState.Record(context.Background(), 0)
+	componentstatus.ReportStatus(p.host, componentstatus.NewEvent(componentstatus.StatusOK))
+}
+
+// decisionKeyEscaper escapes the separators of decision keys, span names and
+// attribute values commonly contain them.
+var decisionKeyEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `/`, `\/`)
+
+// decisionKey identifies the rate limit decisions of a descriptor.
+func decisionKey(entries []*pb_struct.RateLimitDescriptor_Entry) string {
+	var key strings.Builder
+	for i, entry := range entries {
+		if i > 0 {
+			key.WriteByte(',')
+		}
+		decisionKeyEscaper.WriteString(&key, entry.Key)
+		key.WriteByte('/')
+		decisionKeyEscaper.WriteString(&key, entry.Value)
+	}
+	return key.String()
 }
 
 func (p *rateLimiterProcessor) getTenantId(ctx context.Context) (string, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
+	tenantIDHeaders, ok := headers.Get(ctx, p.tenantIDHeaderName)
 	if !ok {
 		return "", fmt.Errorf("could not extract headers from context")
 	}
-
-	tenantIDHeaders := md.Get(p.tenantIDHeaderName)
 	if len(tenantIDHeaders) == 0 {
 		return "", fmt.Errorf("missing header: %s", p.tenantIDHeaderName)
 	} else if len(tenantIDHeaders) > 1 {
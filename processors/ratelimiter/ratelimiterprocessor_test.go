@@ -1,25 +1,42 @@
 package ratelimiter
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
 	"testing"
+	"time"
 
 	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
 	internalmetadata "github.com/hypertrace/collector/processors/ratelimiter/internal/metadata"
 	"github.com/hypertrace/collector/processors/testutil"
+	"go.opentelemetry.io/collector/client"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
 	"go.opentelemetry.io/collector/processor"
+	"go.opentelemetry.io/collector/receiver/otlpreceiver"
+	"go.opentelemetry.io/collector/receiver/receivertest"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
@@ -65,6 +82,22 @@ func (m *MockProcessorConsumer) ConsumeTraces(ctx context.Context, ld ptrace.Tra
 	return args.Get(0).(error)
 }
 
+func (m *MockProcessorConsumer) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
+	args := m.Called(ctx, md)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(error)
+}
+
+func (m *MockProcessorConsumer) ConsumeLogs(ctx context.Context, ld plog.Logs) error {
+	args := m.Called(ctx, ld)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(error)
+}
+
 func TestRateLimitingWhenEmptyTenantHeader(t *testing.T) {
 	mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
 	mockProcessorConsumerObj := new(MockProcessorConsumer)
@@ -76,7 +109,6 @@ func TestRateLimitingWhenEmptyTenantHeader(t *testing.T) {
 		domain:                     defaultDomain,
 		rateLimitServiceClient:     mockRateLimitServiceClientObj,
 		rateLimitServiceClientConn: &grpc.ClientConn{},
-		cancelFunc:                 t.SkipNow,
 		nextConsumer:               mockProcessorConsumerObj,
 		telemetryBuilder:           telemetryBuilder,
 	}
@@ -107,7 +139,6 @@ func TestWhenRateLimitServiceCallFailed(t *testing.T) {
 		domain:                     defaultDomain,
 		rateLimitServiceClient:     mockRateLimitServiceClientObj,
 		rateLimitServiceClientConn: &grpc.ClientConn{},
-		cancelFunc:                 t.SkipNow,
 		nextConsumer:               mockProcessorConsumerObj,
 		telemetryBuilder:           telemetryBuilder,
 	}
@@ -138,7 +169,6 @@ func TestRateLimitingWhenTenantLimitReached(t *testing.T) {
 		domain:                     defaultDomain,
 		rateLimitServiceClient:     mockRateLimitServiceClientObj,
 		rateLimitServiceClientConn: &grpc.ClientConn{},
-		cancelFunc:                 t.SkipNow,
 		nextConsumer:               mockProcessorConsumerObj,
 		telemetryBuilder:           telemetryBuilder,
 	}
@@ -165,3 +195,442 @@ func TestRateLimitingWhenTenantLimitReached(t *testing.T) {
 	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 1)
 	mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeTraces", 0)
 }
+
+func TestRateLimitingWithClientMetadata(t *testing.T) {
+	mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+	mockProcessorConsumerObj := new(MockProcessorConsumer)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:                     zap.NewNop(),
+		tenantIDHeaderName:         defaultHeaderName,
+		domain:                     defaultDomain,
+		rateLimitServiceClient:     mockRateLimitServiceClientObj,
+		rateLimitServiceClientConn: &grpc.ClientConn{},
+		nextConsumer:               mockProcessorConsumerObj,
+		telemetryBuilder:           telemetryBuilder,
+	}
+	rateLimitResponse := &pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+		Statuses: []*pb.RateLimitResponse_DescriptorStatus{
+			{
+				Code: pb.RateLimitResponse_OVER_LIMIT,
+			},
+		},
+	}
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.MatchedBy(func(req *pb.RateLimitRequest) bool {
+		return req.Descriptors[0].Entries[0].Value == testTenantID
+	})).Return(rateLimitResponse, nil)
+	traces := testutil.NewTestTraces(testutil.NewTestSpan())
+	// OTLP/HTTP and Zipkin receivers with include_metadata expose headers through client.Info.
+	ctx := client.NewContext(context.Background(), client.Info{
+		Metadata: client.NewMetadata(map[string][]string{"X-Tenant-Id": {testTenantID}}),
+	})
+	err = p.ConsumeTraces(ctx, traces)
+	require.NoError(t, err)
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 1)
+	mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeTraces", 0)
+}
+
+func TestRateLimitingMetricsAndLogs(t *testing.T) {
+	metrics := pmetric.NewMetrics()
+	dps := metrics.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyGauge().DataPoints()
+	dps.AppendEmpty()
+	dps.AppendEmpty()
+	dps.AppendEmpty()
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	records.AppendEmpty()
+	records.AppendEmpty()
+
+	tests := []struct {
+		name          string
+		descriptorKey string
+		hitsAddend    uint32
+		consume       func(ctx context.Context, p *rateLimiterProcessor) error
+		consumeMethod string
+	}{
+		{
+			name:          "metrics",
+			descriptorKey: TenantDataPoints,
+			hitsAddend:    3,
+			consume: func(ctx context.Context, p *rateLimiterProcessor) error {
+				return p.ConsumeMetrics(ctx, metrics)
+			},
+			consumeMethod: "ConsumeMetrics",
+		},
+		{
+			name:          "logs",
+			descriptorKey: TenantLogRecords,
+			hitsAddend:    2,
+			consume: func(ctx context.Context, p *rateLimiterProcessor) error {
+				return p.ConsumeLogs(ctx, logs)
+			},
+			consumeMethod: "ConsumeLogs",
+		},
+	}
+	for _, tt := range tests {
+		for _, code := range []pb.RateLimitResponse_Code{pb.RateLimitResponse_OK, pb.RateLimitResponse_OVER_LIMIT} {
+			t.Run(fmt.Sprintf("%s %s", tt.name, code), func(t *testing.T) {
+				mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+				mockProcessorConsumerObj := new(MockProcessorConsumer)
+				telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+				require.NoError(t, err)
+				p := &rateLimiterProcessor{
+					logger:                     zap.NewNop(),
+					tenantIDHeaderName:         defaultHeaderName,
+					domain:                     defaultDomain,
+					rateLimitServiceClient:     mockRateLimitServiceClientObj,
+					rateLimitServiceClientConn: &grpc.ClientConn{},
+					nextMetricsConsumer:        mockProcessorConsumerObj,
+					nextLogsConsumer:           mockProcessorConsumerObj,
+					telemetryBuilder:           telemetryBuilder,
+				}
+				rateLimitResponse := &pb.RateLimitResponse{
+					OverallCode: code,
+					Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: code}},
+				}
+				mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.MatchedBy(func(req *pb.RateLimitRequest) bool {
+					entry := req.Descriptors[0].Entries[0]
+					return entry.Key == tt.descriptorKey && entry.Value == testTenantID && req.HitsAddend == tt.hitsAddend
+				})).Return(rateLimitResponse, nil)
+				mockProcessorConsumerObj.On(tt.consumeMethod, mock.Anything, mock.Anything).Return(nil)
+				ctx := metadata.NewIncomingContext(
+					context.Background(),
+					metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+				)
+				err = tt.consume(ctx, p)
+				require.NoError(t, err)
+				mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 1)
+				if code == pb.RateLimitResponse_OVER_LIMIT {
+					mockProcessorConsumerObj.AssertNumberOfCalls(t, tt.consumeMethod, 0)
+				} else {
+					mockProcessorConsumerObj.AssertNumberOfCalls(t, tt.consumeMethod, 1)
+				}
+			})
+		}
+	}
+}
+
+func TestRateLimitingBytes(t *testing.T) {
+	traces := testutil.NewTestTraces(testutil.NewTestSpan(), testutil.NewTestSpan())
+	metrics := pmetric.NewMetrics()
+	metrics.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyGauge().DataPoints().AppendEmpty()
+	logs := plog.NewLogs()
+	logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("hello")
+
+	tests := []struct {
+		name          string
+		descriptorKey string
+		hitsAddend    int
+		consume       func(ctx context.Context, p *rateLimiterProcessor) error
+	}{
+		{
+			name:          "traces",
+			descriptorKey: TenantSpans,
+			hitsAddend:    (&ptrace.ProtoMarshaler{}).TracesSize(traces),
+			consume: func(ctx context.Context, p *rateLimiterProcessor) error {
+				return p.ConsumeTraces(ctx, traces)
+			},
+		},
+		{
+			name:          "metrics",
+			descriptorKey: TenantDataPoints,
+			hitsAddend:    (&pmetric.ProtoMarshaler{}).MetricsSize(metrics),
+			consume: func(ctx context.Context, p *rateLimiterProcessor) error {
+				return p.ConsumeMetrics(ctx, metrics)
+			},
+		},
+		{
+			name:          "logs",
+			descriptorKey: TenantLogRecords,
+			hitsAddend:    (&plog.ProtoMarshaler{}).LogsSize(logs),
+			consume: func(ctx context.Context, p *rateLimiterProcessor) error {
+				return p.ConsumeLogs(ctx, logs)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+			mockProcessorConsumerObj := new(MockProcessorConsumer)
+			telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+			require.NoError(t, err)
+			p := &rateLimiterProcessor{
+				logger:                     zap.NewNop(),
+				tenantIDHeaderName:         defaultHeaderName,
+				domain:                     defaultDomain,
+				rateLimitServiceClient:     mockRateLimitServiceClientObj,
+				rateLimitServiceClientConn: &grpc.ClientConn{},
+				nextConsumer:               mockProcessorConsumerObj,
+				nextMetricsConsumer:        mockProcessorConsumerObj,
+				nextLogsConsumer:           mockProcessorConsumerObj,
+				telemetryBuilder:           telemetryBuilder,
+				hitsUnit:                   HitsUnitBytes,
+			}
+			require.Positive(t, tt.hitsAddend)
+			mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.MatchedBy(func(req *pb.RateLimitRequest) bool {
+				entry := req.Descriptors[0].Entries[0]
+				return entry.Key == tt.descriptorKey && req.HitsAddend == uint32(tt.hitsAddend)
+			})).Return(&pb.RateLimitResponse{
+				OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+				Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OVER_LIMIT}},
+			}, nil)
+			ctx := metadata.NewIncomingContext(
+				context.Background(),
+				metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+			)
+			require.NoError(t, tt.consume(ctx, p))
+			mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 1)
+			assert.Empty(t, mockProcessorConsumerObj.Calls)
+		})
+	}
+}
+
+func TestToHitsAddend(t *testing.T) {
+	assert.Equal(t, uint32(42), toHitsAddend(42))
+	assert.Equal(t, uint32(math.MaxUint32), toHitsAddend(math.MaxUint32+1))
+}
+
+func TestRateLimitingFailureModes(t *testing.T) {
+	overLimitResponse := &pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+		Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OVER_LIMIT}},
+	}
+	okResponse := &pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OK,
+		Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OK}},
+	}
+	tests := []struct {
+		name          string
+		failureMode   FailureMode
+		lastResponse  *pb.RateLimitResponse
+		wantForwarded bool
+	}{
+		{name: "open", failureMode: FailureModeOpen, wantForwarded: true},
+		{name: "default", wantForwarded: true},
+		{name: "closed", failureMode: FailureModeClosed, wantForwarded: false},
+		{name: "last decision without decision", failureMode: FailureModeLastDecision, wantForwarded: true},
+		{name: "last decision over limit", failureMode: FailureModeLastDecision, lastResponse: overLimitResponse, wantForwarded: false},
+		{name: "last decision ok", failureMode: FailureModeLastDecision, lastResponse: okResponse, wantForwarded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+			mockProcessorConsumerObj := new(MockProcessorConsumer)
+			telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+			require.NoError(t, err)
+			p := &rateLimiterProcessor{
+				logger:                     zap.NewNop(),
+				tenantIDHeaderName:         defaultHeaderName,
+				domain:                     defaultDomain,
+				rateLimitServiceClient:     mockRateLimitServiceClientObj,
+				rateLimitServiceClientConn: &grpc.ClientConn{},
+				nextConsumer:               mockProcessorConsumerObj,
+				telemetryBuilder:           telemetryBuilder,
+				failureMode:                tt.failureMode,
+			}
+			mockProcessorConsumerObj.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+			ctx := metadata.NewIncomingContext(
+				context.Background(),
+				metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+			)
+			if tt.lastResponse != nil {
+				mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(tt.lastResponse, nil).Once()
+				require.NoError(t, p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan())))
+				mockProcessorConsumerObj.Calls = nil
+			}
+			mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("rate limit called failed"))
+
+			err = p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan()))
+			require.NoError(t, err)
+			if tt.wantForwarded {
+				mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeTraces", 1)
+			} else {
+				mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeTraces", 0)
+			}
+		})
+	}
+}
+
+func TestRateLimitingCircuitBreaker(t *testing.T) {
+	mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+	mockProcessorConsumerObj := new(MockProcessorConsumer)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:                     zap.NewNop(),
+		tenantIDHeaderName:         defaultHeaderName,
+		domain:                     defaultDomain,
+		rateLimitServiceClient:     mockRateLimitServiceClientObj,
+		rateLimitServiceClientConn: &grpc.ClientConn{},
+		nextConsumer:               mockProcessorConsumerObj,
+		telemetryBuilder:           telemetryBuilder,
+		failureMode:                FailureModeClosed,
+	}
+	p.circuitBreaker = newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, ProbeInterval: time.Hour}, p.onCircuitBreakerStateChange)
+	require.NoError(t, p.Start(context.Background(), componenttest.NewNopHost()))
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("rate limit called failed"))
+	mockProcessorConsumerObj.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+	)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan())))
+	}
+	// The breaker opened after two failures, the remaining batches skip the call.
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 2)
+	mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeTraces", 0)
+}
+
+func TestRateLimitingCachesOverLimit(t *testing.T) {
+	mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+	mockProcessorConsumerObj := new(MockProcessorConsumer)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:                     zap.NewNop(),
+		tenantIDHeaderName:         defaultHeaderName,
+		domain:                     defaultDomain,
+		rateLimitServiceClient:     mockRateLimitServiceClientObj,
+		rateLimitServiceClientConn: &grpc.ClientConn{},
+		nextConsumer:               mockProcessorConsumerObj,
+		nextMetricsConsumer:        mockProcessorConsumerObj,
+		telemetryBuilder:           telemetryBuilder,
+		overLimitCache:             newOverLimitCache(),
+	}
+	rateLimitResponse := &pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+		Statuses: []*pb.RateLimitResponse_DescriptorStatus{
+			{
+				Code:               pb.RateLimitResponse_OVER_LIMIT,
+				DurationUntilReset: durationpb.New(time.Minute),
+			},
+		},
+	}
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.MatchedBy(func(req *pb.RateLimitRequest) bool {
+		return req.Descriptors[0].Entries[0].Key == TenantSpans
+	})).Return(rateLimitResponse, nil)
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(&pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OK,
+		Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OK}},
+	}, nil)
+	mockProcessorConsumerObj.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+	mockProcessorConsumerObj.On("ConsumeMetrics", mock.Anything, mock.Anything).Return(nil)
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+	)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan())))
+	}
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 1)
+	mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeTraces", 0)
+
+	// The cached decision only applies to the descriptor key it was taken for.
+	require.NoError(t, p.ConsumeMetrics(ctx, pmetric.NewMetrics()))
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 2)
+	mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeMetrics", 1)
+}
+
+func TestRateLimitingRejectOverLimit(t *testing.T) {
+	mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+	mockProcessorConsumerObj := new(MockProcessorConsumer)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:                     zap.NewNop(),
+		tenantIDHeaderName:         defaultHeaderName,
+		domain:                     defaultDomain,
+		rateLimitServiceClient:     mockRateLimitServiceClientObj,
+		rateLimitServiceClientConn: &grpc.ClientConn{},
+		nextConsumer:               mockProcessorConsumerObj,
+		telemetryBuilder:           telemetryBuilder,
+		overLimitCache:             newOverLimitCache(),
+		rejectOverLimit:            true,
+	}
+	rateLimitResponse := &pb.RateLimitResponse{
+		OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+		Statuses: []*pb.RateLimitResponse_DescriptorStatus{
+			{
+				Code:               pb.RateLimitResponse_OVER_LIMIT,
+				DurationUntilReset: durationpb.New(30 * time.Second),
+			},
+		},
+	}
+	mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(rateLimitResponse, nil)
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+	)
+
+	for i := 0; i < 2; i++ {
+		err = p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan()))
+		st, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, codes.ResourceExhausted, st.Code())
+		require.Len(t, st.Details(), 1)
+		retryInfo := st.Details()[0].(*errdetails.RetryInfo)
+		// The second batch is answered from the cache, before the limit resets.
+		assert.InDelta(t, 30*time.Second, retryInfo.RetryDelay.AsDuration(), float64(time.Second))
+	}
+	mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", 1)
+	mockProcessorConsumerObj.AssertNumberOfCalls(t, "ConsumeTraces", 0)
+}
+
+func TestRateLimitedErrorWithoutRetryDelay(t *testing.T) {
+	p := &rateLimiterProcessor{}
+	assert.NoError(t, p.rateLimitedError(time.Second))
+
+	p.rejectOverLimit = true
+	st, ok := status.FromError(p.rateLimitedError(0))
+	require.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Empty(t, st.Details())
+}
+
+func TestReceiveOTLPHTTPOverLimit(t *testing.T) {
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p := &rateLimiterProcessor{
+		logger:             zap.NewNop(),
+		tenantIDHeaderName: defaultHeaderName,
+		nextConsumer:       consumertest.NewNop(),
+		telemetryBuilder:   telemetryBuilder,
+		localRateLimiter: newLocalRateLimiter(LocalConfig{
+			Tenants: map[string]BucketConfig{testTenantID: {SpansPerSecond: 1, Burst: 1}},
+		}, zap.NewNop()),
+		rejectOverLimit: true,
+	}
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	factory := otlpreceiver.NewFactory()
+	cfg := factory.CreateDefaultConfig().(*otlpreceiver.Config)
+	cfg.GRPC = nil
+	cfg.HTTP.ServerConfig.Endpoint = addr
+	cfg.HTTP.ServerConfig.IncludeMetadata = true
+	rec, err := factory.CreateTracesReceiver(context.Background(), receivertest.NewNopSettings(), cfg, p)
+	require.NoError(t, err)
+	require.NoError(t, rec.Start(context.Background(), componenttest.NewNopHost()))
+	defer rec.Shutdown(context.Background())
+
+	// Empty the bucket.
+	allowed, _ := p.localRateLimiter.allow(testTenantID, 1)
+	require.True(t, allowed)
+	body, err := ptraceotlp.NewExportRequestFromTraces(testutil.NewTestTraces(testutil.NewTestSpan(), testutil.NewTestSpan())).MarshalProto()
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/v1/traces", bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set(defaultHeaderName, testTenantID)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const tagDescriptor string = "descriptor"
+
+// shadowLogger logs the tenants that would have been limited in shadow mode,
+// at most once per interval per tenant. Tenants logged more than an interval
+// ago are forgotten.
+type shadowLogger struct {
+	logger   *zap.Logger
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	loggedAt  map[string]time.Time
+	lastSweep time.Time
+}
+
+// newShadowLogger returns nil when the interval is not positive, which disables logs.
+func newShadowLogger(interval time.Duration, logger *zap.Logger) *shadowLogger {
+	if interval <= 0 {
+		return nil
+	}
+	return &shadowLogger{
+		logger:   logger,
+		interval: interval,
+		now:      time.Now,
+		loggedAt: map[string]time.Time{},
+	}
+}
+
+func (l *shadowLogger) log(tenantID, descriptor string, count int) {
+	now := l.now()
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) >= l.interval {
+		l.lastSweep = now
+		for t, loggedAt := range l.loggedAt {
+			if now.Sub(loggedAt) >= l.interval {
+				delete(l.loggedAt, t)
+			}
+		}
+	}
+	loggedAt, ok := l.loggedAt[tenantID]
+	logged := !ok || now.Sub(loggedAt) >= l.interval
+	if logged {
+		l.loggedAt[tenantID] = now
+	}
+	l.mu.Unlock()
+	if logged {
+		l.logger.Info(fmt.Sprintf("shadow mode: would drop %d items of tenant %s as rate limit of descriptor %s exceeded", count, tenantID, descriptor))
+	}
+}
+
+// recordShadowDrop counts the items that would have been dropped in shadow mode.
+// The descriptor is named after its configured entry keys, see descriptorName.
+func (p *rateLimiterProcessor) recordShadowDrop(ctx context.Context, tenantID, descriptor string, count int) {
+	p.telemetryBuilder.ProcessorShadowDroppedCount.Add(ctx, int64(count), metric.WithAttributes(
+		attribute.String(tagTenantID, tenantID),
+		attribute.String(tagDescriptor, descriptor),
+	))
+	if p.shadowLogger != nil {
+		p.shadowLogger.log(tenantID, descriptor, count)
+	}
+}
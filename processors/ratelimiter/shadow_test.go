@@ -0,0 +1,101 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	internalmetadata "github.com/hypertrace/collector/processors/ratelimiter/internal/metadata"
+	"github.com/hypertrace/collector/processors/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestShadowLogger(t *testing.T) {
+	assert.Nil(t, newShadowLogger(0, zap.NewNop()))
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	l := newShadowLogger(time.Minute, zap.New(core))
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	l.log("tenant1", "tenant_spans", 10)
+	l.log("tenant1", "tenant_spans", 10)
+	l.log("tenant2", "tenant_spans", 5)
+	assert.Equal(t, 2, logs.Len())
+
+	now = now.Add(time.Minute)
+	l.log("tenant1", "tenant_spans", 10)
+	assert.Equal(t, 3, logs.Len())
+	assert.Equal(t, "shadow mode: would drop 10 items of tenant tenant1 as rate limit of descriptor tenant_spans exceeded", logs.All()[2].Message)
+	// tenant2 was logged an interval ago, so it is forgotten.
+	assert.Len(t, l.loggedAt, 1)
+	assert.Contains(t, l.loggedAt, "tenant1")
+}
+
+func TestRateLimitingShadowMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		descriptors []DescriptorConfig
+		maxGroups   int
+		wantCalls   int
+		wantLog     string
+	}{
+		{name: "tenant", wantCalls: 1, wantLog: "shadow mode: would drop 6 items of tenant jdoe as rate limit of descriptor tenant_spans exceeded"},
+		{name: "descriptors", descriptors: testDescriptors, wantCalls: 5, wantLog: "shadow mode: would drop 5 items of tenant jdoe as rate limit of descriptor tenant_spans,service exceeded"},
+		{name: "descriptor groups limit", descriptors: testDescriptors, maxGroups: 2, wantCalls: 3, wantLog: "shadow mode: would drop 2 items of tenant jdoe as rate limit of descriptor tenant_spans,service exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+			tracesSink := new(consumertest.TracesSink)
+			telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+			require.NoError(t, err)
+			core, logs := observer.New(zapcore.InfoLevel)
+			p := &rateLimiterProcessor{
+				logger:                     zap.NewNop(),
+				tenantIDHeaderName:         defaultHeaderName,
+				domain:                     defaultDomain,
+				rateLimitServiceClient:     mockRateLimitServiceClientObj,
+				rateLimitServiceClientConn: &grpc.ClientConn{},
+				nextConsumer:               tracesSink,
+				telemetryBuilder:           telemetryBuilder,
+				descriptors:                tt.descriptors,
+				maxDescriptorGroups:        tt.maxGroups,
+				rejectOverLimit:            true,
+				shadow:                     true,
+				shadowLogger:               newShadowLogger(time.Minute, zap.New(core)),
+			}
+			mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(&pb.RateLimitResponse{
+				OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+				Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OVER_LIMIT}},
+			}, nil)
+			ctx := metadata.NewIncomingContext(
+				context.Background(),
+				metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+			)
+
+			traces := newDescriptorTestTraces()
+			require.NoError(t, p.ConsumeTraces(ctx, traces))
+			mockRateLimitServiceClientObj.AssertNumberOfCalls(t, "ShouldRateLimit", tt.wantCalls)
+			require.Len(t, tracesSink.AllTraces(), 1)
+			assert.Equal(t, 6, tracesSink.AllTraces()[0].SpanCount())
+			// The tenant is logged once per interval, under the configured descriptor.
+			require.Equal(t, 1, logs.Len())
+			assert.Equal(t, tt.wantLog, logs.All()[0].Message)
+
+			require.NoError(t, p.ConsumeTraces(ctx, testutil.NewTestTraces(testutil.NewTestSpan())))
+			assert.Len(t, tracesSink.AllTraces(), 2)
+			assert.Equal(t, 1, logs.Len())
+		})
+	}
+}
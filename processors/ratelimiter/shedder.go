@@ -0,0 +1,70 @@
+package ratelimiter
+
+import (
+	"hash/fnv"
+	"math"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// shedder selects the spans kept from over limit batches.
+type shedder struct {
+	cfg SheddingConfig
+	// threshold is the trace ID hash below which traces are sampled.
+	threshold uint64
+}
+
+func newShedder(cfg *SheddingConfig) *shedder {
+	if cfg == nil {
+		return nil
+	}
+	return &shedder{
+		cfg:       *cfg,
+		threshold: uint64(cfg.SamplingPercentage / 100 * (math.MaxUint32 + 1)),
+	}
+}
+
+// shed removes the spans that are not kept and returns the number of spans left.
+func (s *shedder) shed(traces ptrace.Traces) int {
+	traces.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				return !s.keep(span)
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+	return traces.SpanCount()
+}
+
+// keep reports whether the span is kept although its tenant is over limit.
+func (s *shedder) keep(span ptrace.Span) bool {
+	return s.isPriority(span) || s.sampled(span)
+}
+
+func (s *shedder) isPriority(span ptrace.Span) bool {
+	if s.cfg.KeepErrors && span.Status().Code() == ptrace.StatusCodeError {
+		return true
+	}
+	if s.cfg.KeepServerSpans && span.Kind() == ptrace.SpanKindServer {
+		return true
+	}
+	for _, attr := range s.cfg.KeepAttributes {
+		if v, ok := span.Attributes().Get(attr.Key); ok && (attr.Value == "" || v.AsString() == attr.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled hashes the trace ID, so all spans of a trace get the same decision.
+func (s *shedder) sampled(span ptrace.Span) bool {
+	if s.threshold == 0 {
+		return false
+	}
+	traceID := span.TraceID()
+	h := fnv.New32a()
+	_, _ = h.Write(traceID[:])
+	return uint64(h.Sum32()) < s.threshold
+}
@@ -0,0 +1,144 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	internalmetadata "github.com/hypertrace/collector/processors/ratelimiter/internal/metadata"
+	"github.com/hypertrace/collector/processors/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestShedderKeep(t *testing.T) {
+	errorSpan := testutil.NewTestSpanWithNameAndSpanKind(ptrace.SpanKindClient, "error")
+	errorSpan.Status().SetCode(ptrace.StatusCodeError)
+	serverSpan := testutil.NewTestSpanWithNameAndSpanKind(ptrace.SpanKindServer, "server")
+	clientSpan := testutil.NewTestSpanWithNameAndSpanKind(ptrace.SpanKindClient, "client")
+	flaggedSpan := testutil.NewTestSpanWithNameAndSpanKind(ptrace.SpanKindClient, "flagged", "priority", "high")
+
+	tests := []struct {
+		name     string
+		cfg      SheddingConfig
+		span     ptrace.Span
+		wantKeep bool
+	}{
+		{name: "nothing kept", span: errorSpan, wantKeep: false},
+		{name: "error kept", cfg: SheddingConfig{KeepErrors: true}, span: errorSpan, wantKeep: true},
+		{name: "server kept", cfg: SheddingConfig{KeepServerSpans: true}, span: serverSpan, wantKeep: true},
+		{name: "client dropped", cfg: SheddingConfig{KeepErrors: true, KeepServerSpans: true}, span: clientSpan, wantKeep: false},
+		{
+			name:     "attribute kept",
+			cfg:      SheddingConfig{KeepAttributes: []AttributeMatchConfig{{Key: "priority"}}},
+			span:     flaggedSpan,
+			wantKeep: true,
+		},
+		{
+			name:     "attribute value kept",
+			cfg:      SheddingConfig{KeepAttributes: []AttributeMatchConfig{{Key: "priority", Value: "high"}}},
+			span:     flaggedSpan,
+			wantKeep: true,
+		},
+		{
+			name:     "other attribute value dropped",
+			cfg:      SheddingConfig{KeepAttributes: []AttributeMatchConfig{{Key: "priority", Value: "low"}}},
+			span:     flaggedSpan,
+			wantKeep: false,
+		},
+		{name: "all sampled", cfg: SheddingConfig{SamplingPercentage: 100}, span: clientSpan, wantKeep: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantKeep, newShedder(&tt.cfg).keep(tt.span))
+		})
+	}
+}
+
+func TestShedderSampling(t *testing.T) {
+	s := newShedder(&SheddingConfig{SamplingPercentage: 25})
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		traceID := testutil.CreateNewTraceId()
+		span := testutil.NewTestSpanWithTraceId(traceID)
+		keep := s.keep(span)
+		// Every span of a trace gets the same decision.
+		assert.Equal(t, keep, s.keep(testutil.NewTestSpanWithTraceId(traceID)))
+		if keep {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 2500, sampled, 300)
+}
+
+func TestRateLimitingShedding(t *testing.T) {
+	errorSpan := testutil.NewTestSpanWithNameAndSpanKind(ptrace.SpanKindClient, "error")
+	errorSpan.Status().SetCode(ptrace.StatusCodeError)
+
+	tests := []struct {
+		name          string
+		traces        ptrace.Traces
+		wantSpanNames []string
+	}{
+		{
+			name:          "priority spans forwarded",
+			traces:        testutil.NewTestTraces(errorSpan, testutil.NewTestSpanWithNameAndSpanKind(ptrace.SpanKindClient, "client")),
+			wantSpanNames: []string{"error"},
+		},
+		{
+			name:   "nothing left",
+			traces: testutil.NewTestTraces(testutil.NewTestSpanWithNameAndSpanKind(ptrace.SpanKindClient, "client")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRateLimitServiceClientObj := new(MockRateLimitServiceClient)
+			tracesSink := new(consumertest.TracesSink)
+			telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+			require.NoError(t, err)
+			p := &rateLimiterProcessor{
+				logger:                     zap.NewNop(),
+				tenantIDHeaderName:         defaultHeaderName,
+				domain:                     defaultDomain,
+				rateLimitServiceClient:     mockRateLimitServiceClientObj,
+				rateLimitServiceClientConn: &grpc.ClientConn{},
+				nextConsumer:               tracesSink,
+				telemetryBuilder:           telemetryBuilder,
+				rejectOverLimit:            true,
+				shedder:                    newShedder(&SheddingConfig{KeepErrors: true}),
+			}
+			mockRateLimitServiceClientObj.On("ShouldRateLimit", mock.Anything, mock.Anything).Return(&pb.RateLimitResponse{
+				OverallCode: pb.RateLimitResponse_OVER_LIMIT,
+				Statuses:    []*pb.RateLimitResponse_DescriptorStatus{{Code: pb.RateLimitResponse_OVER_LIMIT}},
+			}, nil)
+			ctx := metadata.NewIncomingContext(
+				context.Background(),
+				metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID}),
+			)
+
+			err = p.ConsumeTraces(ctx, tt.traces)
+			if len(tt.wantSpanNames) == 0 {
+				assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+				assert.Empty(t, tracesSink.AllTraces())
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, tracesSink.AllTraces(), 1)
+			spans := tracesSink.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans()
+			var spanNames []string
+			for i := 0; i < spans.Len(); i++ {
+				spanNames = append(spanNames, spans.At(i).Name())
+			}
+			assert.Equal(t, tt.wantSpanNames, spanNames)
+		})
+	}
+}
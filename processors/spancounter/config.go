@@ -1,11 +1,46 @@
 package spancounter
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 type Config struct {
 	// TenantIDAttributeKey defines span attribute key for tenant. Default tenant-id.
 	TenantIDAttributeKey string         `mapstructure:"tenant_id_attribute_key"`
 	TenantConfigs        []TenantConfig `mapstructure:"tenant_configs"`
+	// IncludeTenantID adds the tenant ID of the matched spans as a dimension of
+	// the processor telemetry. Default false.
+	IncludeTenantID bool `mapstructure:"include_tenant_id"`
+	// IncludeServiceName adds the service name of the matched spans as a dimension
+	// of the processor telemetry. Default false.
+	IncludeServiceName bool `mapstructure:"include_service_name"`
+}
+
+// ConnectorConfig is the config of the spancounter connector, the criteria of
+// the processor and the limits of the series the connector counts.
+type ConnectorConfig struct {
+	Config `mapstructure:",squash"`
+	// SeriesExpiration is how long the connector keeps the count of a tenant,
+	// service and label without matching spans. An expired series starts over
+	// from zero with a new start time. Connector only. Default 5m.
+	SeriesExpiration time.Duration `mapstructure:"series_expiration"`
+	// MaxSeries limits the series the connector keeps counts of, spans of new
+	// series are not counted while it is reached. Connector only. Default 10000.
+	MaxSeries int `mapstructure:"max_series"`
 }
 
+// TenantConfig defines the criteria of the services of a tenant. The tenant ID
+// and service name * apply to every tenant and service. The criteria of a span
+// are merged from the entries of its tenant and service, *, in precedence order:
+//  1. tenant ID and service name
+//  2. tenant ID and *
+//  3. * and service name
+//  4. * and *
+//
+// When entries of different precedence have criteria of the same label, only the
+// criteria of the highest precedence entry apply.
 type TenantConfig struct {
 	TenantId       string          `mapstructure:"tenant_id"`
 	ServiceConfigs []ServiceConfig `mapstructure:"service_configs"`
@@ -18,12 +53,93 @@ type ServiceConfig struct {
 
 type SpanConfig struct {
 	// This is used to identify matches in the metrics. It should be unique.
-	Label          string          `mapstructure:"label"`
+	Label string `mapstructure:"label"`
+	// MatchType defines how SpanName and the attribute values are matched,
+	// strict, regexp or glob. Default strict.
+	MatchType      MatchType       `mapstructure:"match_type"`
 	SpanName       string          `mapstructure:"span_name"`
 	SpanAttributes []SpanAttribute `mapstructure:"span_attributes"`
+	// SpanKind matches spans of a kind: unspecified, internal, server, client,
+	// producer or consumer.
+	SpanKind string `mapstructure:"span_kind"`
+	// StatusCode matches spans of a status code: unset, ok or error.
+	StatusCode string `mapstructure:"status_code"`
+	// MinDuration matches spans lasting at least as long.
+	MinDuration time.Duration `mapstructure:"min_duration"`
+	// MaxDuration matches spans lasting less.
+	MaxDuration time.Duration `mapstructure:"max_duration"`
 }
 
+// SpanAttribute matches a span attribute. Without operator, the attribute is
+// required to exist when Value is empty and to equal Value otherwise.
 type SpanAttribute struct {
-	Key   string `mapstructure:"key"`
+	Key string `mapstructure:"key"`
+	// Operator defines how the attribute is compared to Value or Values.
+	Operator AttributeOperator `mapstructure:"operator"`
+	// Value is parsed as the type of the attribute, e.g. 500 matches int
+	// and string attributes, unless it is a regexp or glob pattern.
 	Value string `mapstructure:"value"`
+	// Values are the values of the in and not_in operators.
+	Values []string `mapstructure:"values"`
+}
+
+// AttributeOperator is how a span attribute is compared.
+type AttributeOperator string
+
+const (
+	AttributeOperatorEquals    AttributeOperator = "equals"
+	AttributeOperatorNotEquals AttributeOperator = "not_equals"
+	AttributeOperatorIn        AttributeOperator = "in"
+	AttributeOperatorNotIn     AttributeOperator = "not_in"
+	AttributeOperatorExists    AttributeOperator = "exists"
+	AttributeOperatorNotExists AttributeOperator = "not_exists"
+	// AttributeOperatorGt and the other comparisons match int and double attributes.
+	AttributeOperatorGt  AttributeOperator = "gt"
+	AttributeOperatorGte AttributeOperator = "gte"
+	AttributeOperatorLt  AttributeOperator = "lt"
+	AttributeOperatorLte AttributeOperator = "lte"
+	// AttributeOperatorPrefix and AttributeOperatorSuffix match string attributes.
+	AttributeOperatorPrefix AttributeOperator = "prefix"
+	AttributeOperatorSuffix AttributeOperator = "suffix"
+)
+
+// MatchType is how span names and attribute values are matched by the equals,
+// not_equals, in and not_in operators. Regexp and glob patterns match int, double
+// and bool attributes by their string form, e.g. 5.. matches the int 503.
+type MatchType string
+
+const (
+	// MatchTypeStrict matches equal values.
+	MatchTypeStrict MatchType = "strict"
+	// MatchTypeRegexp matches values against a regular expression, which is not
+	// anchored, use ^ and $ to match whole values.
+	MatchTypeRegexp MatchType = "regexp"
+	// MatchTypeGlob matches whole values against a pattern where * matches any
+	// sequence of characters and ? a single character.
+	MatchTypeGlob MatchType = "glob"
+)
+
+func (cfg *ConnectorConfig) Validate() error {
+	var errs error
+	if cfg.SeriesExpiration < 0 {
+		errs = errors.Join(errs, errors.New("series_expiration must not be negative"))
+	}
+	if cfg.MaxSeries < 0 {
+		errs = errors.Join(errs, errors.New("max_series must not be negative"))
+	}
+	return errors.Join(errs, cfg.Config.Validate())
+}
+
+func (cfg *Config) Validate() error {
+	var errs error
+	for i, tc := range cfg.TenantConfigs {
+		for j, sc := range tc.ServiceConfigs {
+			for k, spanConfig := range sc.SpanConfigs {
+				if _, err := newSpanCriteria(spanConfig); err != nil {
+					errs = errors.Join(errs, fmt.Errorf("tenant_configs[%d]: service_configs[%d]: span_configs[%d]: %w", i, j, k, err))
+				}
+			}
+		}
+	}
+	return errs
 }
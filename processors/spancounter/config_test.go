@@ -0,0 +1,99 @@
+package spancounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/confmap"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		spanConfigs []SpanConfig
+		wantErr     string
+	}{
+		{
+			name:        "strict",
+			spanConfigs: []SpanConfig{{SpanName: "span-(", SpanAttributes: []SpanAttribute{{Key: "k1", Value: "v*"}}}},
+		},
+		{
+			name:        "valid patterns",
+			spanConfigs: []SpanConfig{{MatchType: MatchTypeRegexp, SpanName: `^span-\d+$`}, {MatchType: MatchTypeGlob, SpanName: "span-["}},
+		},
+		{
+			name:        "invalid span name regexp",
+			spanConfigs: []SpanConfig{{}, {MatchType: MatchTypeRegexp, SpanName: "span-("}},
+			wantErr:     "tenant_configs[0]: service_configs[0]: span_configs[1]: span_name: invalid regexp \"span-(\": error parsing regexp: missing closing ): `span-(`",
+		},
+		{
+			name: "invalid attribute value regexp",
+			spanConfigs: []SpanConfig{{MatchType: MatchTypeRegexp, SpanAttributes: []SpanAttribute{
+				{Key: "k1"},
+				{Key: "k2", Value: "v["},
+			}}},
+			wantErr: "tenant_configs[0]: service_configs[0]: span_configs[0]: span_attributes[1]: value: invalid regexp \"v[\": error parsing regexp: missing closing ]: `[`",
+		},
+		{
+			name:        "span predicates",
+			spanConfigs: []SpanConfig{{SpanKind: "server", StatusCode: "error", MinDuration: time.Second, MaxDuration: 2 * time.Second}},
+		},
+		{
+			name:        "invalid span predicates",
+			spanConfigs: []SpanConfig{{SpanKind: "SERVER", StatusCode: "failed", MinDuration: -time.Second}},
+			wantErr: "tenant_configs[0]: service_configs[0]: span_configs[0]: unknown span_kind \"SERVER\"\n" +
+				"unknown status_code \"failed\"\n" +
+				"min_duration must not be negative",
+		},
+		{
+			name:        "max duration not greater than min duration",
+			spanConfigs: []SpanConfig{{MinDuration: 2 * time.Second, MaxDuration: time.Second}},
+			wantErr:     "tenant_configs[0]: service_configs[0]: span_configs[0]: max_duration must be greater than min_duration",
+		},
+		{
+			name:        "unknown match type",
+			spanConfigs: []SpanConfig{{MatchType: "fuzzy"}},
+			wantErr:     `tenant_configs[0]: service_configs[0]: span_configs[0]: unknown match_type "fuzzy"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{TenantConfigs: []TenantConfig{{
+				TenantId:       "example-tenant",
+				ServiceConfigs: []ServiceConfig{{ServiceName: "example-service", SpanConfigs: tt.spanConfigs}},
+			}}}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConnectorConfig(t *testing.T) {
+	assert.NoError(t, (&ConnectorConfig{SeriesExpiration: time.Minute, MaxSeries: 10}).Validate())
+	invalidCriteria := Config{TenantConfigs: []TenantConfig{{
+		ServiceConfigs: []ServiceConfig{{SpanConfigs: []SpanConfig{{MatchType: "fuzzy"}}}},
+	}}}
+	assert.EqualError(t, (&ConnectorConfig{Config: invalidCriteria, SeriesExpiration: -time.Minute, MaxSeries: -1}).Validate(),
+		"series_expiration must not be negative\nmax_series must not be negative\n"+
+			`tenant_configs[0]: service_configs[0]: span_configs[0]: unknown match_type "fuzzy"`)
+}
+
+func TestUnmarshalConnectorConfig(t *testing.T) {
+	cfg := createDefaultConnectorConfig().(*ConnectorConfig)
+	require.NoError(t, confmap.NewFromStringMap(map[string]any{
+		"tenant_id_attribute_key": "tenant",
+		"series_expiration":       "1m",
+		"max_series":              10,
+	}).Unmarshal(cfg))
+	assert.Equal(t, &ConnectorConfig{
+		Config:           Config{TenantIDAttributeKey: "tenant"},
+		SeriesExpiration: time.Minute,
+		MaxSeries:        10,
+	}, cfg)
+}
@@ -0,0 +1,222 @@
+package spancounter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/connector"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	conventions "go.opentelemetry.io/collector/semconv/v1.6.1"
+	"go.uber.org/zap"
+)
+
+const (
+	// metricCriteriaSpanCount is the name of the sum emitted by the connector.
+	metricCriteriaSpanCount = "criteria_span_count"
+	scopeName               = "github.com/hypertrace/collector/processors/spancounter"
+
+	defaultSeriesExpiration = 5 * time.Minute
+	defaultMaxSeries        = 10000
+)
+
+// NewConnectorFactory creates a factory for the spancounter connector. It takes
+// the criteria of the processor, but turns the span counts into metrics instead
+// of collector telemetry.
+func NewConnectorFactory() connector.Factory {
+	return connector.NewFactory(
+		Type,
+		createDefaultConnectorConfig,
+		connector.WithTracesToMetrics(createTracesToMetricsConnector, component.StabilityLevelDevelopment),
+	)
+}
+
+func createDefaultConnectorConfig() component.Config {
+	return &ConnectorConfig{
+		Config: Config{
+			TenantIDAttributeKey: defaultTenantIDAttributeKey,
+		},
+	}
+}
+
+func createTracesToMetricsConnector(
+	_ context.Context,
+	params connector.Settings,
+	cfg component.Config,
+	nextConsumer consumer.Metrics,
+) (connector.Traces, error) {
+	cCfg := cfg.(*ConnectorConfig)
+	addUniqueLabelsToSpanConfigs(&cCfg.Config)
+	params.Logger.Info("Criteria based span counter connector config", zap.Any("config", cCfg))
+	return newConnector(params.Logger, cCfg, nextConsumer)
+}
+
+// seriesKey identifies a span count series.
+type seriesKey struct {
+	tenantId    string
+	serviceName string
+	label       string
+}
+
+// seriesCount is the cumulative span count of a series since its start.
+type seriesCount struct {
+	start pcommon.Timestamp
+	count int64
+	// lastSeen is when spans of the series were last counted.
+	lastSeen time.Time
+}
+
+// spanCounterConnector counts the spans matching the criteria and emits them as
+// cumulative monotonic sums, so the prometheus exporter keeps the totals across
+// batches. Tenants and services come from the data, so series idle for longer
+// than the expiration are removed and the number of series is limited.
+type spanCounterConnector struct {
+	component.StartFunc
+	component.ShutdownFunc
+
+	logger *zap.Logger
+	tenantsCriteria
+	nextConsumer consumer.Metrics
+
+	seriesExpiration time.Duration
+	maxSeries        int
+
+	mu     sync.Mutex
+	series map[seriesKey]*seriesCount
+	// lastExpiry is when expired series were last removed.
+	lastExpiry time.Time
+	now        func() time.Time
+}
+
+func newConnector(logger *zap.Logger, cfg *ConnectorConfig, nextConsumer consumer.Metrics) (*spanCounterConnector, error) {
+	tc, err := newTenantsCriteria(&cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	seriesExpiration := defaultSeriesExpiration
+	if cfg.SeriesExpiration > 0 {
+		seriesExpiration = cfg.SeriesExpiration
+	}
+	maxSeries := defaultMaxSeries
+	if cfg.MaxSeries > 0 {
+		maxSeries = cfg.MaxSeries
+	}
+	return &spanCounterConnector{
+		logger:           logger,
+		tenantsCriteria:  tc,
+		nextConsumer:     nextConsumer,
+		seriesExpiration: seriesExpiration,
+		maxSeries:        maxSeries,
+		series:           make(map[seriesKey]*seriesCount),
+		now:              time.Now,
+	}, nil
+}
+
+func (c *spanCounterConnector) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+func (c *spanCounterConnector) ConsumeTraces(ctx context.Context, traces ptrace.Traces) error {
+	if len(c.tenantsMap) == 0 {
+		return nil
+	}
+
+	counts := make(map[seriesKey]int64)
+	rss := traces.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		tenantId, serviceName, spanConfigs := c.resourceCriteria(rs)
+		for _, sc := range spanConfigs {
+			spanCount := 0
+			for j := 0; j < rs.ScopeSpans().Len(); j++ {
+				scss := rs.ScopeSpans().At(j)
+				for k := 0; k < scss.Spans().Len(); k++ {
+					if spanMatchesConfig(scss.Spans().At(k), sc) {
+						spanCount++
+					}
+				}
+			}
+
+			if spanCount > 0 {
+				counts[seriesKey{tenantId: tenantId, serviceName: serviceName, label: sc.Label}] += int64(spanCount)
+			}
+		}
+	}
+
+	if len(counts) == 0 {
+		return nil
+	}
+	md := c.buildMetrics(counts)
+	if md.DataPointCount() == 0 {
+		return nil
+	}
+	return c.nextConsumer.ConsumeMetrics(ctx, md)
+}
+
+// buildMetrics adds the counts to the cumulative ones and returns a sum with a
+// data point for each of the updated series. Counts of new series are dropped
+// while the series limit is reached.
+func (c *spanCounterConnector) buildMetrics(counts map[seriesKey]int64) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName(scopeName)
+	m := sm.Metrics().AppendEmpty()
+	m.SetName(metricCriteriaSpanCount)
+	m.SetDescription("Number of spans matching the span criteria")
+	m.SetUnit("{spans}")
+	sum := m.SetEmptySum()
+	sum.SetIsMonotonic(true)
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dps := sum.DataPoints()
+	dps.EnsureCapacity(len(counts))
+
+	nowTime := c.now()
+	now := pcommon.NewTimestampFromTime(nowTime)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expireSeries(nowTime)
+	dropped := 0
+	for key, count := range counts {
+		s, ok := c.series[key]
+		if !ok {
+			if len(c.series) >= c.maxSeries {
+				dropped++
+				continue
+			}
+			s = &seriesCount{start: now}
+			c.series[key] = s
+		}
+		s.count += count
+		s.lastSeen = nowTime
+
+		dp := dps.AppendEmpty()
+		dp.SetStartTimestamp(s.start)
+		dp.SetTimestamp(now)
+		dp.SetIntValue(s.count)
+		dp.Attributes().PutStr(c.tenantIDAttributeKey, key.tenantId)
+		dp.Attributes().PutStr(conventions.AttributeServiceName, key.serviceName)
+		dp.Attributes().PutStr(tagSpanCriteriaLabel, key.label)
+	}
+	if dropped > 0 {
+		c.logger.Warn("span count series limit reached, not counting new series", zap.Int("max_series", c.maxSeries), zap.Int("dropped_series", dropped))
+	}
+	return md
+}
+
+// expireSeries removes the series without spans for longer than the expiration.
+// The series are scanned at most once per expiration.
+func (c *spanCounterConnector) expireSeries(now time.Time) {
+	if now.Sub(c.lastExpiry) < c.seriesExpiration {
+		return
+	}
+	c.lastExpiry = now
+	for key, s := range c.series {
+		if now.Sub(s.lastSeen) > c.seriesExpiration {
+			delete(c.series, key)
+		}
+	}
+}
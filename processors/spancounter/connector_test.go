@@ -0,0 +1,216 @@
+package spancounter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/connector/connectortest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	conventions "go.opentelemetry.io/collector/semconv/v1.6.1"
+	"go.uber.org/zap"
+)
+
+func TestCreateTracesToMetricsConnector(t *testing.T) {
+	factory := NewConnectorFactory()
+	assert.Equal(t, Type, factory.Type())
+
+	cfg := factory.CreateDefaultConfig()
+	assert.IsType(t, &ConnectorConfig{}, cfg)
+	conn, err := factory.CreateTracesToMetrics(context.Background(), connectortest.NewNopSettings(), cfg, consumertest.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, conn.Start(context.Background(), componenttest.NewNopHost()))
+	assert.NoError(t, conn.ConsumeTraces(context.Background(), ptrace.NewTraces()))
+	assert.NoError(t, conn.Shutdown(context.Background()))
+}
+
+func TestConnectorConsumeTraces(t *testing.T) {
+	c := &ConnectorConfig{Config: Config{
+		TenantConfigs: []TenantConfig{
+			{
+				TenantId: "example-tenant-1",
+				ServiceConfigs: []ServiceConfig{
+					{
+						ServiceName: wildcard,
+						SpanConfigs: []SpanConfig{
+							{
+								Label:    "server-spans",
+								SpanKind: "server",
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+	sink := new(consumertest.MetricsSink)
+	conn, err := newConnector(zap.NewNop(), c, sink)
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	conn.now = func() time.Time { return now }
+
+	td := ptrace.NewTraces()
+	for _, r := range []struct {
+		serviceName string
+		kinds       []ptrace.SpanKind
+	}{
+		{serviceName: "example-service-1", kinds: []ptrace.SpanKind{ptrace.SpanKindServer, ptrace.SpanKindClient, ptrace.SpanKindServer}},
+		{serviceName: "example-service-2", kinds: []ptrace.SpanKind{ptrace.SpanKindClient}},
+		{serviceName: "example-service-1", kinds: []ptrace.SpanKind{ptrace.SpanKindServer}},
+	} {
+		rs := td.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr(defaultTenantIDAttributeKey, "example-tenant-1")
+		rs.Resource().Attributes().PutStr(conventions.AttributeServiceName, r.serviceName)
+		spans := rs.ScopeSpans().AppendEmpty().Spans()
+		for _, kind := range r.kinds {
+			spans.AppendEmpty().SetKind(kind)
+		}
+	}
+
+	require.NoError(t, conn.ConsumeTraces(context.Background(), td))
+	now = now.Add(time.Minute)
+	require.NoError(t, conn.ConsumeTraces(context.Background(), td))
+
+	require.Len(t, sink.AllMetrics(), 2)
+	for i, want := range []int64{3, 6} {
+		md := sink.AllMetrics()[i]
+		require.Equal(t, 1, md.MetricCount())
+		m := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+		assert.Equal(t, metricCriteriaSpanCount, m.Name())
+		require.Equal(t, pmetric.MetricTypeSum, m.Type())
+		assert.True(t, m.Sum().IsMonotonic())
+		assert.Equal(t, pmetric.AggregationTemporalityCumulative, m.Sum().AggregationTemporality())
+		require.Equal(t, 1, m.Sum().DataPoints().Len())
+
+		dp := m.Sum().DataPoints().At(0)
+		assert.Equal(t, want, dp.IntValue())
+		assert.Equal(t, pcommon.NewTimestampFromTime(time.Unix(1700000000, 0)), dp.StartTimestamp())
+		assert.Equal(t, pcommon.NewTimestampFromTime(time.Unix(1700000000, 0).Add(time.Duration(i)*time.Minute)), dp.Timestamp())
+		assert.Equal(t, map[string]any{
+			defaultTenantIDAttributeKey:      "example-tenant-1",
+			conventions.AttributeServiceName: "example-service-1",
+			tagSpanCriteriaLabel:             "server-spans",
+		}, dp.Attributes().AsRaw())
+	}
+}
+
+func TestConnectorConsumeTracesWithoutMatches(t *testing.T) {
+	c := &ConnectorConfig{Config: Config{
+		TenantConfigs: []TenantConfig{
+			{
+				TenantId: "example-tenant-1",
+				ServiceConfigs: []ServiceConfig{
+					{
+						ServiceName: "example-service-1",
+						SpanConfigs: []SpanConfig{{Label: "span-1", SpanName: "span-1"}},
+					},
+				},
+			},
+		},
+	}}
+	sink := new(consumertest.MetricsSink)
+	conn, err := newConnector(zap.NewNop(), c, sink)
+	require.NoError(t, err)
+
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr(defaultTenantIDAttributeKey, "example-tenant-1")
+	rs.Resource().Attributes().PutStr(conventions.AttributeServiceName, "example-service-1")
+	rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetName("span-2")
+
+	require.NoError(t, conn.ConsumeTraces(context.Background(), td))
+	assert.Empty(t, sink.AllMetrics())
+}
+
+// newConnectorTestTraces returns a trace with a server span of every service
+// of the tenant.
+func newConnectorTestTraces(tenantId string, serviceNames ...string) ptrace.Traces {
+	td := ptrace.NewTraces()
+	for _, serviceName := range serviceNames {
+		rs := td.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr(defaultTenantIDAttributeKey, tenantId)
+		rs.Resource().Attributes().PutStr(conventions.AttributeServiceName, serviceName)
+		rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetKind(ptrace.SpanKindServer)
+	}
+	return td
+}
+
+// sumDataPoints returns the data points of the sum by service name.
+func sumDataPoints(t *testing.T, md pmetric.Metrics) map[string]pmetric.NumberDataPoint {
+	t.Helper()
+	dps := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Sum().DataPoints()
+	byService := make(map[string]pmetric.NumberDataPoint, dps.Len())
+	for i := 0; i < dps.Len(); i++ {
+		serviceName, ok := dps.At(i).Attributes().Get(conventions.AttributeServiceName)
+		require.True(t, ok)
+		byService[serviceName.Str()] = dps.At(i)
+	}
+	return byService
+}
+
+func TestConnectorExpiresIdleSeries(t *testing.T) {
+	c := &ConnectorConfig{
+		SeriesExpiration: time.Minute,
+		Config: Config{TenantConfigs: []TenantConfig{
+			{
+				TenantId:       wildcard,
+				ServiceConfigs: []ServiceConfig{{ServiceName: wildcard, SpanConfigs: []SpanConfig{{Label: "all-spans"}}}},
+			},
+		}},
+	}
+	sink := new(consumertest.MetricsSink)
+	conn, err := newConnector(zap.NewNop(), c, sink)
+	require.NoError(t, err)
+	start := time.Unix(1700000000, 0)
+	now := start
+	conn.now = func() time.Time { return now }
+
+	require.NoError(t, conn.ConsumeTraces(context.Background(), newConnectorTestTraces("tenant-1", "service-1", "service-2")))
+	now = start.Add(time.Minute)
+	require.NoError(t, conn.ConsumeTraces(context.Background(), newConnectorTestTraces("tenant-1", "service-1")))
+	now = start.Add(2 * time.Minute)
+	require.NoError(t, conn.ConsumeTraces(context.Background(), newConnectorTestTraces("tenant-1", "service-1")))
+	// service-2 was idle for 2 minutes, so it was removed.
+	assert.Len(t, conn.series, 1)
+	now = start.Add(3 * time.Minute)
+	require.NoError(t, conn.ConsumeTraces(context.Background(), newConnectorTestTraces("tenant-1", "service-1", "service-2")))
+
+	require.Len(t, sink.AllMetrics(), 4)
+	dps := sumDataPoints(t, sink.AllMetrics()[3])
+	assert.Equal(t, int64(4), dps["service-1"].IntValue())
+	assert.Equal(t, pcommon.NewTimestampFromTime(start), dps["service-1"].StartTimestamp())
+	assert.Equal(t, int64(1), dps["service-2"].IntValue())
+	assert.Equal(t, pcommon.NewTimestampFromTime(now), dps["service-2"].StartTimestamp())
+}
+
+func TestConnectorMaxSeries(t *testing.T) {
+	c := &ConnectorConfig{
+		MaxSeries: 2,
+		Config: Config{TenantConfigs: []TenantConfig{
+			{
+				TenantId:       wildcard,
+				ServiceConfigs: []ServiceConfig{{ServiceName: wildcard, SpanConfigs: []SpanConfig{{Label: "all-spans"}}}},
+			},
+		}},
+	}
+	sink := new(consumertest.MetricsSink)
+	conn, err := newConnector(zap.NewNop(), c, sink)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.ConsumeTraces(context.Background(), newConnectorTestTraces("tenant-1", "service-1", "service-2")))
+	require.NoError(t, conn.ConsumeTraces(context.Background(), newConnectorTestTraces("tenant-1", "service-3")))
+	require.NoError(t, conn.ConsumeTraces(context.Background(), newConnectorTestTraces("tenant-1", "service-1", "service-3")))
+
+	// The batch of only service-3 emits nothing.
+	require.Len(t, sink.AllMetrics(), 2)
+	dps := sumDataPoints(t, sink.AllMetrics()[1])
+	assert.Len(t, dps, 1)
+	assert.Equal(t, int64(2), dps["service-1"].IntValue())
+	assert.Len(t, conn.series, 2)
+}
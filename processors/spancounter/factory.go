@@ -46,7 +46,10 @@ func createTracesProcessor(
 		params.Logger.Error("error creating telemetry for the spancounter processor", zap.Error(err))
 		return nil, err
 	}
-	processor := newProcessor(params.Logger, pCfg, telemetryBuilder)
+	processor, err := newProcessor(params.Logger, pCfg, telemetryBuilder)
+	if err != nil {
+		return nil, err
+	}
 	return processorhelper.NewTracesProcessor(
 		ctx,
 		params,
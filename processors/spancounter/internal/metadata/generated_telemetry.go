@@ -30,8 +30,10 @@ func Tracer(settings component.TelemetrySettings) trace.Tracer {
 type TelemetryBuilder struct {
 	// In generated code but unused
 	// meter                           metric.Meter
-	ProcessorCriteriaBasedSpanCount metric.Int64Counter
-	meters                          map[configtelemetry.Level]metric.Meter
+	ProcessorCriteriaBasedSpanCount      metric.Int64Counter
+	ProcessorCriteriaBasedSpanDuration   metric.Float64Histogram
+	ProcessorCriteriaBasedSpanErrorCount metric.Int64Counter
+	meters                               map[configtelemetry.Level]metric.Meter
 }
 
 // TelemetryBuilderOption applies changes to default builder.
@@ -62,5 +64,17 @@ func NewTelemetryBuilder(settings component.TelemetrySettings, options ...Teleme
 		metric.WithUnit("{spans}"),
 	)
 	errs = errors.Join(errs, err)
+	builder.ProcessorCriteriaBasedSpanDuration, err = builder.meters[configtelemetry.LevelBasic].Float64Histogram(
+		"otelcol_criteria_span_duration",
+		metric.WithDescription("Duration of the spans received from a tenant that match a certain criteria"),
+		metric.WithUnit("ms"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorCriteriaBasedSpanErrorCount, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_criteria_span_error_count",
+		metric.WithDescription("Number of spans with an error status received from a tenant that match a certain criteria"),
+		metric.WithUnit("{spans}"),
+	)
+	errs = errors.Join(errs, err)
 	return &builder, errs
 }
@@ -2,6 +2,8 @@ package spancounter
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/hypertrace/collector/processors/spancounter/internal/metadata"
 	"go.opentelemetry.io/collector/pdata/ptrace"
@@ -14,49 +16,141 @@ import (
 const (
 	defaultTenantIDAttributeKey string = "tenant-id"
 	tagSpanCriteriaLabel        string = "span-criteria-label"
+	tagTenantID                 string = "tenant-id"
+	tagServiceName              string = "service-name"
+	// wildcard is the tenant ID or service name of criteria applying to all of them.
+	wildcard string = "*"
 )
 
 type spanCounterProcessor struct {
 	logger *zap.Logger
+	tenantsCriteria
+	telemetryBuilder   *metadata.TelemetryBuilder
+	includeTenantID    bool
+	includeServiceName bool
+}
+
+// tenantsCriteria looks up the span criteria of resources. It is shared by the
+// processor and the connector.
+type tenantsCriteria struct {
+	tenantIDAttributeKey string
 	// The levels are tenant > service > span config. So this is a map of tenant ids
 	// to maps of service names to span configs
-	tenantIDAttributeKey string
-	tenantsMap           map[string]map[string][]SpanConfig
-	telemetryBuilder     *metadata.TelemetryBuilder
+	tenantsMap map[string]map[string][]spanCriteria
+}
+
+func newProcessor(logger *zap.Logger, cfg *Config, telemetryBuilder *metadata.TelemetryBuilder) (*spanCounterProcessor, error) {
+	tc, err := newTenantsCriteria(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &spanCounterProcessor{
+		logger:             logger,
+		tenantsCriteria:    tc,
+		telemetryBuilder:   telemetryBuilder,
+		includeTenantID:    cfg.IncludeTenantID,
+		includeServiceName: cfg.IncludeServiceName,
+	}, nil
 }
 
-func newProcessor(logger *zap.Logger, cfg *Config, telemetryBuilder *metadata.TelemetryBuilder) *spanCounterProcessor {
-	tm := createTenantsMap(cfg)
+func newTenantsCriteria(cfg *Config) (tenantsCriteria, error) {
+	tm, err := createTenantsMap(cfg)
+	if err != nil {
+		return tenantsCriteria{}, err
+	}
 	tenantIDAttributeKey := defaultTenantIDAttributeKey
 	if len(cfg.TenantIDAttributeKey) != 0 {
 		tenantIDAttributeKey = cfg.TenantIDAttributeKey
 	}
-	return &spanCounterProcessor{
-		logger:               logger,
+	return tenantsCriteria{
 		tenantIDAttributeKey: tenantIDAttributeKey,
 		tenantsMap:           tm,
-		telemetryBuilder:     telemetryBuilder,
-	}
+	}, nil
 }
 
-func createTenantsMap(cfg *Config) map[string]map[string][]SpanConfig {
-	m := make(map[string]map[string][]SpanConfig, len(cfg.TenantConfigs))
+// createTenantsMap returns the span criteria per service per tenant, with their
+// patterns compiled.
+func createTenantsMap(cfg *Config) (map[string]map[string][]spanCriteria, error) {
+	m := make(map[string]map[string][]spanCriteria, len(cfg.TenantConfigs))
 	for _, tc := range cfg.TenantConfigs {
 		if len(tc.TenantId) == 0 { // skip empty tenant id
 			continue
 		}
-		sm := make(map[string][]SpanConfig, len(tc.ServiceConfigs))
+		sm := make(map[string][]spanCriteria, len(tc.ServiceConfigs))
 		for _, sc := range tc.ServiceConfigs {
 			if len(sc.ServiceName) == 0 { // skip empty service name
 				continue
 			}
 
-			sm[sc.ServiceName] = sc.SpanConfigs
+			criteria := make([]spanCriteria, 0, len(sc.SpanConfigs))
+			for _, spanConfig := range sc.SpanConfigs {
+				c, err := newSpanCriteria(spanConfig)
+				if err != nil {
+					return nil, fmt.Errorf("span config %s of service %s of tenant %s: %w", spanConfig.Label, sc.ServiceName, tc.TenantId, err)
+				}
+				criteria = append(criteria, c)
+			}
+			sm[sc.ServiceName] = criteria
 		}
 
 		m[tc.TenantId] = sm
 	}
-	return m
+	return m, nil
+}
+
+// spanCriteriaFor returns the criteria of the service of the tenant, merged from
+// the specific and wildcard entries. Criteria of a label only come from the entry
+// with the highest precedence.
+func (t tenantsCriteria) spanCriteriaFor(tenantId, serviceName string) []spanCriteria {
+	var merged []spanCriteria
+	var labels map[string]struct{}
+	for _, key := range [][2]string{
+		{tenantId, serviceName},
+		{tenantId, wildcard},
+		{wildcard, serviceName},
+		{wildcard, wildcard},
+	} {
+		criteria := t.tenantsMap[key[0]][key[1]]
+		if len(criteria) == 0 {
+			continue
+		}
+		if merged == nil {
+			// Most spans only match a single entry.
+			merged = criteria
+			labels = make(map[string]struct{}, len(criteria))
+			for _, c := range criteria {
+				labels[c.Label] = struct{}{}
+			}
+			continue
+		}
+		// Limit the capacity, so appending copies instead of modifying the map entry.
+		merged = merged[:len(merged):len(merged)]
+		for _, c := range criteria {
+			if _, ok := labels[c.Label]; ok {
+				continue
+			}
+			labels[c.Label] = struct{}{}
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+// resourceCriteria returns the tenant id and service name of the resource, and
+// the criteria its spans are matched against. Resources without a tenant id or
+// service name have no criteria.
+func (t tenantsCriteria) resourceCriteria(rs ptrace.ResourceSpans) (string, string, []spanCriteria) {
+	tenantIdVal, found := rs.Resource().Attributes().Get(t.tenantIDAttributeKey)
+	tenantId := tenantIdVal.Str()
+	if !found || len(tenantId) == 0 {
+		return "", "", nil
+	}
+	serviceNameVal, found := rs.Resource().Attributes().Get(conventions.AttributeServiceName)
+	serviceName := serviceNameVal.Str()
+	if !found || len(serviceName) == 0 {
+		return "", "", nil
+	}
+	return tenantId, serviceName, t.spanCriteriaFor(tenantId, serviceName)
 }
 
 func (p *spanCounterProcessor) ProcessTraces(ctx context.Context, traces ptrace.Traces) (ptrace.Traces, error) {
@@ -67,70 +161,43 @@ func (p *spanCounterProcessor) ProcessTraces(ctx context.Context, traces ptrace.
 	rss := traces.ResourceSpans()
 	for i := 0; i < rss.Len(); i++ {
 		rs := rss.At(i)
-		tenantIdVal, found := rs.Resource().Attributes().Get(p.tenantIDAttributeKey)
-		tenantId := tenantIdVal.Str()
-		if !found || len(tenantId) == 0 {
-			continue
-		}
-		servicesMap, found := p.tenantsMap[tenantId]
-		if !found || len(servicesMap) == 0 {
+		tenantId, serviceName, spanConfigs := p.resourceCriteria(rs)
+		if len(spanConfigs) == 0 {
 			continue
 		}
 
-		serviceNameVal, found := rs.Resource().Attributes().Get(conventions.AttributeServiceName)
-		serviceName := serviceNameVal.Str()
-		if !found || len(serviceName) == 0 {
-			continue
+		var dims []attribute.KeyValue
+		if p.includeTenantID {
+			dims = append(dims, attribute.String(tagTenantID, tenantId))
 		}
-
-		spanConfigs, found := servicesMap[serviceName]
-		if !found || len(spanConfigs) == 0 {
-			continue
+		if p.includeServiceName {
+			dims = append(dims, attribute.String(tagServiceName, serviceName))
 		}
-
 		for _, sc := range spanConfigs {
-			spanCount := 0
+			labelAttr := metric.WithAttributes(append(dims, attribute.String(tagSpanCriteriaLabel, sc.Label))...)
+			spanCount, errorCount := 0, 0
 			for j := 0; j < rs.ScopeSpans().Len(); j++ {
 				scss := rs.ScopeSpans().At(j)
 				for k := 0; k < scss.Spans().Len(); k++ {
 					span := scss.Spans().At(k)
 					if spanMatchesConfig(span, sc) {
 						spanCount++
+						if span.Status().Code() == ptrace.StatusCodeError {
+							errorCount++
+						}
+						p.telemetryBuilder.ProcessorCriteriaBasedSpanDuration.Record(ctx, float64(spanDuration(span))/float64(time.Millisecond), labelAttr)
 					}
 				}
 			}
 
 			if spanCount > 0 {
-				p.telemetryBuilder.ProcessorCriteriaBasedSpanCount.Add(ctx, int64(spanCount), metric.WithAttributes(attribute.KeyValue{
-					Key:   attribute.Key(tagSpanCriteriaLabel),
-					Value: attribute.StringValue(sc.Label),
-				}))
+				p.telemetryBuilder.ProcessorCriteriaBasedSpanCount.Add(ctx, int64(spanCount), labelAttr)
+			}
+			if errorCount > 0 {
+				p.telemetryBuilder.ProcessorCriteriaBasedSpanErrorCount.Add(ctx, int64(errorCount), labelAttr)
 			}
 		}
 	}
 
 	return traces, nil
 }
-
-func spanMatchesConfig(span ptrace.Span, spanConfig SpanConfig) bool {
-	// If span name is configured, it needs to match. If not configured, skip this check.
-	if len(spanConfig.SpanName) != 0 && span.Name() != spanConfig.SpanName {
-		return false
-	}
-
-	for _, attr := range spanConfig.SpanAttributes {
-		v, ok := span.Attributes().Get(attr.Key)
-		if !ok {
-			return false
-		}
-
-		// empty value means we are just checking for the presence of attribute.
-		if len(attr.Value) == 0 || attr.Value == v.Str() {
-			continue
-		} else {
-			return false
-		}
-	}
-
-	return true
-}
@@ -3,13 +3,20 @@ package spancounter
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/hypertrace/collector/processors/spancounter/internal/metadata"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configtelemetry"
+	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	conventions "go.opentelemetry.io/collector/semconv/v1.6.1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.uber.org/zap"
 )
 
@@ -46,11 +53,13 @@ func TestNewProcessor(t *testing.T) {
 	telemetryBuilder, err := metadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
 	require.NoError(t, err)
 
-	p := newProcessor(logger, c, telemetryBuilder)
+	p, err := newProcessor(logger, c, telemetryBuilder)
+	require.NoError(t, err)
 	assert.Equal(t, defaultTenantIDAttributeKey, p.tenantIDAttributeKey)
 
 	c.TenantIDAttributeKey = "custom-tenant-id"
-	p = newProcessor(logger, c, telemetryBuilder)
+	p, err = newProcessor(logger, c, telemetryBuilder)
+	require.NoError(t, err)
 	assert.Equal(t, "custom-tenant-id", p.tenantIDAttributeKey)
 }
 
@@ -125,36 +134,38 @@ func TestCreateTenantsMap(t *testing.T) {
 		},
 	}
 
-	expectedMap := map[string]map[string][]SpanConfig{
+	expectedMap := map[string]map[string][]spanCriteria{
 		"example-tenant": {
 			"example-service-1": {
-				{
+				mustNewSpanCriteria(t, SpanConfig{
 					Label:    "example-label-1",
 					SpanName: "span-1",
-				},
+				}),
 			},
 		},
 		"example-tenant-2": {
 			"example-service-10": {
-				{
+				mustNewSpanCriteria(t, SpanConfig{
 					Label:    "example-label-10",
 					SpanName: "span-10",
-				},
+				}),
 			},
 			"example-service-11": {
-				{
+				mustNewSpanCriteria(t, SpanConfig{
 					Label:    "label-11",
 					SpanName: "span-11",
 					SpanAttributes: []SpanAttribute{
 						{Key: "k1"},
 						{Key: "k2", Value: "v2"},
 					},
-				},
+				}),
 			},
 		},
 	}
 
-	assert.Equal(t, expectedMap, createTenantsMap(c))
+	tenantsMap, err := createTenantsMap(c)
+	require.NoError(t, err)
+	assert.Equal(t, expectedMap, tenantsMap)
 }
 
 func TestSpanMatchesConfig(t *testing.T) {
@@ -164,10 +175,10 @@ func TestSpanMatchesConfig(t *testing.T) {
 	span.Attributes().PutStr("a2", "v2")
 
 	sc := SpanConfig{SpanName: "span1"}
-	assert.True(t, spanMatchesConfig(span, sc))
+	assert.True(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{SpanName: "span2"}
-	assert.False(t, spanMatchesConfig(span, sc))
+	assert.False(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{
 		SpanName: "span1",
@@ -175,14 +186,14 @@ func TestSpanMatchesConfig(t *testing.T) {
 			{Key: "a1"},
 		},
 	}
-	assert.True(t, spanMatchesConfig(span, sc))
+	assert.True(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{
 		SpanAttributes: []SpanAttribute{
 			{Key: "a1"},
 		},
 	}
-	assert.True(t, spanMatchesConfig(span, sc))
+	assert.True(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{
 		SpanName: "span1",
@@ -190,7 +201,7 @@ func TestSpanMatchesConfig(t *testing.T) {
 			{Key: "a1", Value: "v1"},
 		},
 	}
-	assert.True(t, spanMatchesConfig(span, sc))
+	assert.True(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{
 		SpanName: "span1",
@@ -199,7 +210,7 @@ func TestSpanMatchesConfig(t *testing.T) {
 			{Key: "a2", Value: "v2"},
 		},
 	}
-	assert.True(t, spanMatchesConfig(span, sc))
+	assert.True(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{
 		SpanName: "span1",
@@ -208,7 +219,7 @@ func TestSpanMatchesConfig(t *testing.T) {
 			{Key: "a2", Value: "v2"},
 		},
 	}
-	assert.True(t, spanMatchesConfig(span, sc))
+	assert.True(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{
 		SpanName: "span1",
@@ -216,21 +227,21 @@ func TestSpanMatchesConfig(t *testing.T) {
 			{Key: "a1", Value: "v3"},
 		},
 	}
-	assert.False(t, spanMatchesConfig(span, sc))
+	assert.False(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{
 		SpanAttributes: []SpanAttribute{
 			{Key: "a1", Value: "v3"},
 		},
 	}
-	assert.False(t, spanMatchesConfig(span, sc))
+	assert.False(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 
 	sc = SpanConfig{
 		SpanAttributes: []SpanAttribute{
 			{Key: "a3"},
 		},
 	}
-	assert.False(t, spanMatchesConfig(span, sc))
+	assert.False(t, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
 }
 
 func TestProcessTraces(t *testing.T) {
@@ -280,7 +291,8 @@ func TestProcessTraces(t *testing.T) {
 	telemetryBuilder, err := metadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
 	require.NoError(t, err)
 
-	p := newProcessor(logger, c, telemetryBuilder)
+	p, err := newProcessor(logger, c, telemetryBuilder)
+	require.NoError(t, err)
 
 	// We cannot verify metrics :( We will verify no errors and no change in traces
 	processedTd, err := p.ProcessTraces(context.Background(), td)
@@ -289,7 +301,8 @@ func TestProcessTraces(t *testing.T) {
 
 	// Non matching tenant should also not throw an error
 	c.TenantConfigs[0].TenantId = "example-tenant-2"
-	p = newProcessor(logger, c, telemetryBuilder)
+	p, err = newProcessor(logger, c, telemetryBuilder)
+	require.NoError(t, err)
 
 	processedTd, err = p.ProcessTraces(context.Background(), td)
 	assert.NoError(t, err)
@@ -297,9 +310,311 @@ func TestProcessTraces(t *testing.T) {
 
 	// Empty config
 	c = &Config{}
-	p = newProcessor(logger, c, telemetryBuilder)
+	p, err = newProcessor(logger, c, telemetryBuilder)
+	require.NoError(t, err)
 
 	processedTd, err = p.ProcessTraces(context.Background(), td)
 	assert.NoError(t, err)
 	assert.Equal(t, td, processedTd)
 }
+
+func mustNewSpanCriteria(t *testing.T, sc SpanConfig) spanCriteria {
+	t.Helper()
+	criteria, err := newSpanCriteria(sc)
+	require.NoError(t, err)
+	return criteria
+}
+
+func TestSpanMatchesConfigPatterns(t *testing.T) {
+	span := ptrace.NewSpan()
+	span.SetName("GET /api/v1/users/42")
+	span.Attributes().PutStr("http.route", "/api/v1/users/{id}")
+	span.Attributes().PutStr("http.method", "GET")
+
+	tests := []struct {
+		name      string
+		sc        SpanConfig
+		wantMatch bool
+	}{
+		{name: "regexp span name", sc: SpanConfig{MatchType: MatchTypeRegexp, SpanName: `^GET /api/v\d+/users/`}, wantMatch: true},
+		{name: "regexp is not anchored", sc: SpanConfig{MatchType: MatchTypeRegexp, SpanName: `users`}, wantMatch: true},
+		{name: "regexp span name mismatch", sc: SpanConfig{MatchType: MatchTypeRegexp, SpanName: `^POST `}, wantMatch: false},
+		{name: "glob span name", sc: SpanConfig{MatchType: MatchTypeGlob, SpanName: "GET /api/*"}, wantMatch: true},
+		{name: "glob single character", sc: SpanConfig{MatchType: MatchTypeGlob, SpanName: "GET /api/v?/users/*"}, wantMatch: true},
+		{name: "glob matches whole name", sc: SpanConfig{MatchType: MatchTypeGlob, SpanName: "/api/*"}, wantMatch: false},
+		{name: "glob quotes regexp characters", sc: SpanConfig{MatchType: MatchTypeGlob, SpanName: "GET /api/v1/users/4."}, wantMatch: false},
+		{name: "strict is not a pattern", sc: SpanConfig{SpanName: "GET /api/*"}, wantMatch: false},
+		{
+			name: "regexp attribute value",
+			sc: SpanConfig{MatchType: MatchTypeRegexp, SpanAttributes: []SpanAttribute{
+				{Key: "http.route", Value: `^/api/v1/users/`},
+				{Key: "http.method", Value: `^(GET|HEAD)$`},
+			}},
+			wantMatch: true,
+		},
+		{
+			name:      "glob attribute value",
+			sc:        SpanConfig{MatchType: MatchTypeGlob, SpanAttributes: []SpanAttribute{{Key: "http.route", Value: "/api/*/users/*"}}},
+			wantMatch: true,
+		},
+		{
+			name:      "glob attribute value mismatch",
+			sc:        SpanConfig{MatchType: MatchTypeGlob, SpanAttributes: []SpanAttribute{{Key: "http.method", Value: "P*"}}},
+			wantMatch: false,
+		},
+		{
+			name:      "glob attribute presence",
+			sc:        SpanConfig{MatchType: MatchTypeGlob, SpanAttributes: []SpanAttribute{{Key: "http.route"}}},
+			wantMatch: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantMatch, spanMatchesConfig(span, mustNewSpanCriteria(t, tt.sc)))
+		})
+	}
+}
+
+func TestCreateTenantsMapInvalidPattern(t *testing.T) {
+	c := &Config{
+		TenantConfigs: []TenantConfig{
+			{
+				TenantId: "example-tenant",
+				ServiceConfigs: []ServiceConfig{
+					{
+						ServiceName: "example-service",
+						SpanConfigs: []SpanConfig{
+							{Label: "example-label", MatchType: MatchTypeRegexp, SpanName: "span-("},
+						},
+					},
+				},
+			},
+		},
+	}
+	_, err := createTenantsMap(c)
+	assert.ErrorContains(t, err, "span config example-label of service example-service of tenant example-tenant: span_name: invalid regexp")
+}
+
+func TestProcessTracesMetrics(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr(defaultTenantIDAttributeKey, "example-tenant-1")
+	rs.Resource().Attributes().PutStr(conventions.AttributeServiceName, "example-service-1")
+	spans := rs.ScopeSpans().AppendEmpty().Spans()
+	for _, d := range []struct {
+		kind     ptrace.SpanKind
+		duration time.Duration
+	}{
+		{kind: ptrace.SpanKindServer, duration: 3 * time.Second},
+		{kind: ptrace.SpanKindServer, duration: time.Second},
+		{kind: ptrace.SpanKindClient, duration: 5 * time.Second},
+		{kind: ptrace.SpanKindServer, duration: 2 * time.Second},
+	} {
+		span := spans.AppendEmpty()
+		span.SetKind(d.kind)
+		span.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+		span.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(d.duration)))
+	}
+
+	c := &Config{
+		TenantConfigs: []TenantConfig{
+			{
+				TenantId: "example-tenant-1",
+				ServiceConfigs: []ServiceConfig{
+					{
+						ServiceName: "example-service-1",
+						SpanConfigs: []SpanConfig{
+							{
+								Label:       "slow-server-spans",
+								SpanKind:    "server",
+								MinDuration: 2 * time.Second,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	telemetryBuilder, reader := newTestTelemetryBuilder(t)
+	p, err := newProcessor(zap.NewNop(), c, telemetryBuilder)
+	require.NoError(t, err)
+
+	_, err = p.ProcessTraces(context.Background(), td)
+	require.NoError(t, err)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	labelAttrs := attribute.NewSet(attribute.String(tagSpanCriteriaLabel, "slow-server-spans"))
+	count := findMetric(t, rm, "otelcol_criteria_span_count").Data.(metricdata.Sum[int64])
+	require.Len(t, count.DataPoints, 1)
+	assert.Equal(t, labelAttrs, count.DataPoints[0].Attributes)
+	assert.Equal(t, int64(2), count.DataPoints[0].Value)
+	duration := findMetric(t, rm, "otelcol_criteria_span_duration").Data.(metricdata.Histogram[float64])
+	require.Len(t, duration.DataPoints, 1)
+	assert.Equal(t, labelAttrs, duration.DataPoints[0].Attributes)
+	assert.Equal(t, uint64(2), duration.DataPoints[0].Count)
+	assert.Equal(t, float64(5000), duration.DataPoints[0].Sum)
+}
+
+func TestProcessTracesMetricsDimensions(t *testing.T) {
+	td := ptrace.NewTraces()
+	for _, r := range []struct {
+		serviceName string
+		statusCodes []ptrace.StatusCode
+	}{
+		{serviceName: "example-service-1", statusCodes: []ptrace.StatusCode{ptrace.StatusCodeOk, ptrace.StatusCodeError, ptrace.StatusCodeError}},
+		{serviceName: "example-service-2", statusCodes: []ptrace.StatusCode{ptrace.StatusCodeUnset}},
+	} {
+		rs := td.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr(defaultTenantIDAttributeKey, "example-tenant-1")
+		rs.Resource().Attributes().PutStr(conventions.AttributeServiceName, r.serviceName)
+		spans := rs.ScopeSpans().AppendEmpty().Spans()
+		for _, code := range r.statusCodes {
+			spans.AppendEmpty().Status().SetCode(code)
+		}
+	}
+
+	c := &Config{
+		IncludeTenantID:    true,
+		IncludeServiceName: true,
+		TenantConfigs: []TenantConfig{
+			{
+				TenantId: "example-tenant-1",
+				ServiceConfigs: []ServiceConfig{
+					{
+						ServiceName: wildcard,
+						SpanConfigs: []SpanConfig{{Label: "all-spans"}},
+					},
+				},
+			},
+		},
+	}
+	telemetryBuilder, reader := newTestTelemetryBuilder(t)
+	p, err := newProcessor(zap.NewNop(), c, telemetryBuilder)
+	require.NoError(t, err)
+
+	_, err = p.ProcessTraces(context.Background(), td)
+	require.NoError(t, err)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	dims := func(serviceName string) attribute.Set {
+		return attribute.NewSet(
+			attribute.String(tagSpanCriteriaLabel, "all-spans"),
+			attribute.String(tagTenantID, "example-tenant-1"),
+			attribute.String(tagServiceName, serviceName),
+		)
+	}
+	counts := map[attribute.Set]int64{}
+	for _, dp := range findMetric(t, rm, "otelcol_criteria_span_count").Data.(metricdata.Sum[int64]).DataPoints {
+		counts[dp.Attributes] = dp.Value
+	}
+	assert.Equal(t, map[attribute.Set]int64{dims("example-service-1"): 3, dims("example-service-2"): 1}, counts)
+	durations := map[attribute.Set]uint64{}
+	for _, dp := range findMetric(t, rm, "otelcol_criteria_span_duration").Data.(metricdata.Histogram[float64]).DataPoints {
+		durations[dp.Attributes] = dp.Count
+	}
+	assert.Equal(t, map[attribute.Set]uint64{dims("example-service-1"): 3, dims("example-service-2"): 1}, durations)
+	errorCount := findMetric(t, rm, "otelcol_criteria_span_error_count").Data.(metricdata.Sum[int64])
+	require.Len(t, errorCount.DataPoints, 1)
+	assert.Equal(t, dims("example-service-1"), errorCount.DataPoints[0].Attributes)
+	assert.Equal(t, int64(2), errorCount.DataPoints[0].Value)
+}
+
+// newTestTelemetryBuilder returns a telemetry builder whose metrics are collected by the reader.
+func newTestTelemetryBuilder(t *testing.T) (*metadata.TelemetryBuilder, *sdkmetric.ManualReader) {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.MeterProvider = meterProvider
+	settings.LeveledMeterProvider = func(configtelemetry.Level) metric.MeterProvider {
+		return meterProvider
+	}
+	telemetryBuilder, err := metadata.NewTelemetryBuilder(settings)
+	require.NoError(t, err)
+	return telemetryBuilder, reader
+}
+
+func findMetric(t *testing.T, rm metricdata.ResourceMetrics, name string) metricdata.Metrics {
+	t.Helper()
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+	require.Failf(t, "metric not found", "metric %s", name)
+	return metricdata.Metrics{}
+}
+
+func TestSpanCriteriaFor(t *testing.T) {
+	c := &Config{
+		TenantConfigs: []TenantConfig{
+			{
+				TenantId: "tenant-1",
+				ServiceConfigs: []ServiceConfig{
+					{ServiceName: "service-1", SpanConfigs: []SpanConfig{{Label: "errors", StatusCode: "error"}, {Label: "tenant-1-service-1"}}},
+					{ServiceName: "*", SpanConfigs: []SpanConfig{{Label: "errors", SpanKind: "server"}, {Label: "tenant-1-all"}}},
+				},
+			},
+			{
+				TenantId: "*",
+				ServiceConfigs: []ServiceConfig{
+					{ServiceName: "service-1", SpanConfigs: []SpanConfig{{Label: "all-service-1"}, {Label: "tenant-1-all", SpanKind: "client"}}},
+					{ServiceName: "*", SpanConfigs: []SpanConfig{{Label: "errors", SpanKind: "client"}, {Label: "all"}}},
+				},
+			},
+		},
+	}
+	telemetryBuilder, err := metadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	p, err := newProcessor(zap.NewNop(), c, telemetryBuilder)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		tenantId    string
+		serviceName string
+		// wantCriteria are the labels and span kinds of the criteria.
+		wantCriteria []string
+	}{
+		{
+			name:         "tenant and service",
+			tenantId:     "tenant-1",
+			serviceName:  "service-1",
+			wantCriteria: []string{"errors/", "tenant-1-service-1/", "tenant-1-all/", "all-service-1/", "all/"},
+		},
+		{
+			name:         "tenant and other service",
+			tenantId:     "tenant-1",
+			serviceName:  "service-2",
+			wantCriteria: []string{"errors/server", "tenant-1-all/", "all/"},
+		},
+		{
+			name:         "other tenant and service",
+			tenantId:     "tenant-2",
+			serviceName:  "service-1",
+			wantCriteria: []string{"all-service-1/", "tenant-1-all/client", "errors/client", "all/"},
+		},
+		{
+			name:         "other tenant and other service",
+			tenantId:     "tenant-2",
+			serviceName:  "service-2",
+			wantCriteria: []string{"errors/client", "all/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var criteria []string
+			for _, sc := range p.spanCriteriaFor(tt.tenantId, tt.serviceName) {
+				criteria = append(criteria, sc.Label+"/"+sc.SpanKind)
+			}
+			assert.Equal(t, tt.wantCriteria, criteria)
+		})
+	}
+	// Merging doesn't modify the entries.
+	assert.Len(t, p.tenantsMap["tenant-1"]["service-1"], 2)
+}
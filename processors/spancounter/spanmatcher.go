@@ -0,0 +1,310 @@
+package spancounter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// spanCriteria is a span config with its patterns compiled.
+type spanCriteria struct {
+	SpanConfig
+	// spanName is nil when the span name is not configured.
+	spanName   valueMatcher
+	attributes []attributeCriteria
+	// spanKind and statusCode are checked when hasSpanKind and hasStatusCode are set.
+	hasSpanKind   bool
+	spanKind      ptrace.SpanKind
+	hasStatusCode bool
+	statusCode    ptrace.StatusCode
+}
+
+var (
+	spanKinds = map[string]ptrace.SpanKind{
+		"unspecified": ptrace.SpanKindUnspecified,
+		"internal":    ptrace.SpanKindInternal,
+		"server":      ptrace.SpanKindServer,
+		"client":      ptrace.SpanKindClient,
+		"producer":    ptrace.SpanKindProducer,
+		"consumer":    ptrace.SpanKindConsumer,
+	}
+	statusCodes = map[string]ptrace.StatusCode{
+		"unset": ptrace.StatusCodeUnset,
+		"ok":    ptrace.StatusCodeOk,
+		"error": ptrace.StatusCodeError,
+	}
+)
+
+type attributeCriteria struct {
+	key      string
+	operator AttributeOperator
+	// values are the values compared to the attribute, matchers matches them
+	// with string attributes.
+	values   []string
+	matchers []valueMatcher
+	// number is the value of the numeric comparisons.
+	number float64
+}
+
+// valueMatcher matches a span name or attribute value.
+type valueMatcher interface {
+	match(value string) bool
+}
+
+type strictMatcher string
+
+func (m strictMatcher) match(value string) bool {
+	return string(m) == value
+}
+
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexpMatcher) match(value string) bool {
+	return m.re.MatchString(value)
+}
+
+func newSpanCriteria(sc SpanConfig) (spanCriteria, error) {
+	switch sc.MatchType {
+	case "", MatchTypeStrict, MatchTypeRegexp, MatchTypeGlob:
+	default:
+		return spanCriteria{}, fmt.Errorf("unknown match_type %q", sc.MatchType)
+	}
+	criteria := spanCriteria{SpanConfig: sc}
+	var errs error
+	if len(sc.SpanKind) != 0 {
+		criteria.spanKind, criteria.hasSpanKind = spanKinds[sc.SpanKind]
+		if !criteria.hasSpanKind {
+			errs = errors.Join(errs, fmt.Errorf("unknown span_kind %q", sc.SpanKind))
+		}
+	}
+	if len(sc.StatusCode) != 0 {
+		criteria.statusCode, criteria.hasStatusCode = statusCodes[sc.StatusCode]
+		if !criteria.hasStatusCode {
+			errs = errors.Join(errs, fmt.Errorf("unknown status_code %q", sc.StatusCode))
+		}
+	}
+	if sc.MinDuration < 0 {
+		errs = errors.Join(errs, errors.New("min_duration must not be negative"))
+	}
+	if sc.MaxDuration < 0 {
+		errs = errors.Join(errs, errors.New("max_duration must not be negative"))
+	}
+	if sc.MaxDuration > 0 && sc.MaxDuration <= sc.MinDuration {
+		errs = errors.Join(errs, errors.New("max_duration must be greater than min_duration"))
+	}
+	if len(sc.SpanName) != 0 {
+		m, err := newValueMatcher(sc.MatchType, sc.SpanName)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("span_name: %w", err))
+		}
+		criteria.spanName = m
+	}
+	for i, attr := range sc.SpanAttributes {
+		ac, err := newAttributeCriteria(sc.MatchType, attr)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("span_attributes[%d]: %w", i, err))
+		}
+		criteria.attributes = append(criteria.attributes, ac)
+	}
+	return criteria, errs
+}
+
+func newAttributeCriteria(matchType MatchType, attr SpanAttribute) (attributeCriteria, error) {
+	ac := attributeCriteria{key: attr.Key, operator: attr.Operator}
+	switch attr.Operator {
+	case "":
+		// empty value means we are just checking for the presence of attribute.
+		ac.operator = AttributeOperatorExists
+		if len(attr.Value) != 0 {
+			ac.operator = AttributeOperatorEquals
+			ac.values = []string{attr.Value}
+		}
+	case AttributeOperatorEquals, AttributeOperatorNotEquals:
+		ac.values = []string{attr.Value}
+	case AttributeOperatorIn, AttributeOperatorNotIn:
+		if len(attr.Values) == 0 {
+			return ac, fmt.Errorf("values are required for operator %s", attr.Operator)
+		}
+		ac.values = attr.Values
+	case AttributeOperatorExists, AttributeOperatorNotExists:
+	case AttributeOperatorGt, AttributeOperatorGte, AttributeOperatorLt, AttributeOperatorLte:
+		number, err := strconv.ParseFloat(attr.Value, 64)
+		if err != nil {
+			return ac, fmt.Errorf("value %q of operator %s is not a number", attr.Value, attr.Operator)
+		}
+		ac.number = number
+	case AttributeOperatorPrefix, AttributeOperatorSuffix:
+		if len(attr.Value) == 0 {
+			return ac, fmt.Errorf("value is required for operator %s", attr.Operator)
+		}
+		ac.values = []string{attr.Value}
+		return ac, nil
+	default:
+		return ac, fmt.Errorf("unknown operator %q", attr.Operator)
+	}
+	var errs error
+	for _, value := range ac.values {
+		m, err := newValueMatcher(matchType, value)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("value: %w", err))
+		}
+		ac.matchers = append(ac.matchers, m)
+	}
+	return ac, errs
+}
+
+func newValueMatcher(matchType MatchType, pattern string) (valueMatcher, error) {
+	switch matchType {
+	case "", MatchTypeStrict:
+		return strictMatcher(pattern), nil
+	case MatchTypeRegexp:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp %q: %w", pattern, err)
+		}
+		return regexpMatcher{re: re}, nil
+	default: // MatchTypeGlob, newSpanCriteria rejects unknown match types.
+		return regexpMatcher{re: regexp.MustCompile(globToRegexp(pattern))}, nil
+	}
+}
+
+// globToRegexp returns the anchored regular expression of a glob pattern.
+func globToRegexp(pattern string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func spanMatchesConfig(span ptrace.Span, criteria spanCriteria) bool {
+	// If span name is configured, it needs to match. If not configured, skip this check.
+	if criteria.spanName != nil && !criteria.spanName.match(span.Name()) {
+		return false
+	}
+	if criteria.hasSpanKind && span.Kind() != criteria.spanKind {
+		return false
+	}
+	if criteria.hasStatusCode && span.Status().Code() != criteria.statusCode {
+		return false
+	}
+	if criteria.MinDuration > 0 || criteria.MaxDuration > 0 {
+		duration := spanDuration(span)
+		if duration < criteria.MinDuration || (criteria.MaxDuration > 0 && duration >= criteria.MaxDuration) {
+			return false
+		}
+	}
+
+	for _, attr := range criteria.attributes {
+		if !attr.matches(span.Attributes()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches reports whether the attribute of attrs satisfies the criteria. Missing
+// attributes only match the not_exists, not_equals and not_in operators.
+func (ac attributeCriteria) matches(attrs pcommon.Map) bool {
+	v, ok := attrs.Get(ac.key)
+	switch ac.operator {
+	case AttributeOperatorExists:
+		return ok
+	case AttributeOperatorNotExists:
+		return !ok
+	case AttributeOperatorNotEquals, AttributeOperatorNotIn:
+		return !ok || !ac.equalsAny(v)
+	}
+	if !ok {
+		return false
+	}
+	switch ac.operator {
+	case AttributeOperatorEquals, AttributeOperatorIn:
+		return ac.equalsAny(v)
+	case AttributeOperatorPrefix:
+		return v.Type() == pcommon.ValueTypeStr && strings.HasPrefix(v.Str(), ac.values[0])
+	case AttributeOperatorSuffix:
+		return v.Type() == pcommon.ValueTypeStr && strings.HasSuffix(v.Str(), ac.values[0])
+	}
+
+	var number float64
+	switch v.Type() {
+	case pcommon.ValueTypeInt:
+		number = float64(v.Int())
+	case pcommon.ValueTypeDouble:
+		number = v.Double()
+	default:
+		return false
+	}
+	switch ac.operator {
+	case AttributeOperatorGt:
+		return number > ac.number
+	case AttributeOperatorGte:
+		return number >= ac.number
+	case AttributeOperatorLt:
+		return number < ac.number
+	case AttributeOperatorLte:
+		return number <= ac.number
+	}
+	return false
+}
+
+// equalsAny reports whether the attribute value equals one of the values,
+// parsed as the type of the attribute.
+func (ac attributeCriteria) equalsAny(v pcommon.Value) bool {
+	for i, value := range ac.values {
+		if valueEquals(v, value, ac.matchers[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueEquals parses value as the type of strictly matched int, double and bool
+// attributes. Patterns match the string form of every type, e.g. 5.. matches 503.
+func valueEquals(v pcommon.Value, value string, matcher valueMatcher) bool {
+	if _, ok := matcher.(strictMatcher); !ok {
+		return matcher.match(v.AsString())
+	}
+	switch v.Type() {
+	case pcommon.ValueTypeStr:
+		return matcher.match(v.Str())
+	case pcommon.ValueTypeInt:
+		i, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && i == v.Int()
+	case pcommon.ValueTypeDouble:
+		f, err := strconv.ParseFloat(value, 64)
+		return err == nil && f == v.Double()
+	case pcommon.ValueTypeBool:
+		b, err := strconv.ParseBool(value)
+		return err == nil && b == v.Bool()
+	default:
+		return matcher.match(v.AsString())
+	}
+}
+
+// spanDuration returns the duration of the span, zero when it ends before it starts.
+func spanDuration(span ptrace.Span) time.Duration {
+	if span.EndTimestamp() < span.StartTimestamp() {
+		return 0
+	}
+	return span.EndTimestamp().AsTime().Sub(span.StartTimestamp().AsTime())
+}
@@ -0,0 +1,150 @@
+package spancounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestAttributeOperators(t *testing.T) {
+	span := ptrace.NewSpan()
+	span.Attributes().PutStr("str", "/api/v1/users")
+	span.Attributes().PutInt("int", 500)
+	span.Attributes().PutDouble("double", 0.25)
+	span.Attributes().PutBool("bool", true)
+
+	tests := []struct {
+		name      string
+		attr      SpanAttribute
+		matchType MatchType
+		wantMatch bool
+	}{
+		// Configs without operator keep their meaning.
+		{name: "legacy presence", attr: SpanAttribute{Key: "int"}, wantMatch: true},
+		{name: "legacy presence missing", attr: SpanAttribute{Key: "missing"}, wantMatch: false},
+		{name: "legacy str value", attr: SpanAttribute{Key: "str", Value: "/api/v1/users"}, wantMatch: true},
+		{name: "legacy str value mismatch", attr: SpanAttribute{Key: "str", Value: "/api"}, wantMatch: false},
+
+		{name: "str equals", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorEquals, Value: "/api/v1/users"}, wantMatch: true},
+		{name: "str equals glob", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorEquals, Value: "/api/*"}, matchType: MatchTypeGlob, wantMatch: true},
+		{name: "str not equals", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorNotEquals, Value: "/api"}, wantMatch: true},
+		{name: "str in", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorIn, Values: []string{"/health", "/api/v1/users"}}, wantMatch: true},
+		{name: "str not in", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorNotIn, Values: []string{"/health", "/api/v1/users"}}, wantMatch: false},
+		{name: "str prefix", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorPrefix, Value: "/api/"}, wantMatch: true},
+		{name: "str prefix mismatch", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorPrefix, Value: "/health"}, wantMatch: false},
+		{name: "str suffix", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorSuffix, Value: "/users"}, wantMatch: true},
+		{name: "str gt", attr: SpanAttribute{Key: "str", Operator: AttributeOperatorGt, Value: "0"}, wantMatch: false},
+
+		{name: "int equals", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorEquals, Value: "500"}, wantMatch: true},
+		{name: "int legacy value", attr: SpanAttribute{Key: "int", Value: "500"}, wantMatch: true},
+		{name: "int equals not a number", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorEquals, Value: "5xx"}, wantMatch: false},
+		{name: "int not equals", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorNotEquals, Value: "200"}, wantMatch: true},
+		{name: "int in", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorIn, Values: []string{"500", "503"}}, wantMatch: true},
+		{name: "int not in", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorNotIn, Values: []string{"200", "204"}}, wantMatch: true},
+		{name: "int gt", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorGt, Value: "499"}, wantMatch: true},
+		{name: "int gt equal", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorGt, Value: "500"}, wantMatch: false},
+		{name: "int gte", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorGte, Value: "500"}, wantMatch: true},
+		{name: "int lt", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorLt, Value: "500"}, wantMatch: false},
+		{name: "int lte", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorLte, Value: "500.5"}, wantMatch: true},
+		{name: "int equals regexp", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorEquals, Value: "^5..$"}, matchType: MatchTypeRegexp, wantMatch: true},
+		{name: "int equals glob", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorEquals, Value: "5*"}, matchType: MatchTypeGlob, wantMatch: true},
+		{name: "int in glob mismatch", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorIn, Values: []string{"2*", "3*"}}, matchType: MatchTypeGlob, wantMatch: false},
+		{name: "int prefix", attr: SpanAttribute{Key: "int", Operator: AttributeOperatorPrefix, Value: "5"}, wantMatch: false},
+
+		{name: "double equals", attr: SpanAttribute{Key: "double", Operator: AttributeOperatorEquals, Value: "0.25"}, wantMatch: true},
+		{name: "double in", attr: SpanAttribute{Key: "double", Operator: AttributeOperatorIn, Values: []string{"0.5", "0.25"}}, wantMatch: true},
+		{name: "double gt", attr: SpanAttribute{Key: "double", Operator: AttributeOperatorGt, Value: "0.2"}, wantMatch: true},
+		{name: "double gte", attr: SpanAttribute{Key: "double", Operator: AttributeOperatorGte, Value: "0.3"}, wantMatch: false},
+		{name: "double lt", attr: SpanAttribute{Key: "double", Operator: AttributeOperatorLt, Value: "1"}, wantMatch: true},
+		{name: "double lte", attr: SpanAttribute{Key: "double", Operator: AttributeOperatorLte, Value: "0.25"}, wantMatch: true},
+		{name: "double equals glob", attr: SpanAttribute{Key: "double", Operator: AttributeOperatorEquals, Value: "0.2?"}, matchType: MatchTypeGlob, wantMatch: true},
+
+		{name: "bool equals", attr: SpanAttribute{Key: "bool", Operator: AttributeOperatorEquals, Value: "true"}, wantMatch: true},
+		{name: "bool not equals", attr: SpanAttribute{Key: "bool", Operator: AttributeOperatorNotEquals, Value: "true"}, wantMatch: false},
+		{name: "bool in", attr: SpanAttribute{Key: "bool", Operator: AttributeOperatorIn, Values: []string{"false"}}, wantMatch: false},
+		{name: "bool equals regexp", attr: SpanAttribute{Key: "bool", Operator: AttributeOperatorEquals, Value: "^t"}, matchType: MatchTypeRegexp, wantMatch: true},
+		{name: "bool gt", attr: SpanAttribute{Key: "bool", Operator: AttributeOperatorGt, Value: "0"}, wantMatch: false},
+
+		{name: "exists", attr: SpanAttribute{Key: "bool", Operator: AttributeOperatorExists}, wantMatch: true},
+		{name: "not exists", attr: SpanAttribute{Key: "bool", Operator: AttributeOperatorNotExists}, wantMatch: false},
+		{name: "missing not exists", attr: SpanAttribute{Key: "missing", Operator: AttributeOperatorNotExists}, wantMatch: true},
+		{name: "missing equals", attr: SpanAttribute{Key: "missing", Operator: AttributeOperatorEquals, Value: ""}, wantMatch: false},
+		{name: "missing not equals", attr: SpanAttribute{Key: "missing", Operator: AttributeOperatorNotEquals, Value: "500"}, wantMatch: true},
+		{name: "missing not in", attr: SpanAttribute{Key: "missing", Operator: AttributeOperatorNotIn, Values: []string{"500"}}, wantMatch: true},
+		{name: "missing gte", attr: SpanAttribute{Key: "missing", Operator: AttributeOperatorGte, Value: "0"}, wantMatch: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := SpanConfig{MatchType: tt.matchType, SpanAttributes: []SpanAttribute{tt.attr}}
+			assert.Equal(t, tt.wantMatch, spanMatchesConfig(span, mustNewSpanCriteria(t, sc)))
+		})
+	}
+}
+
+func TestNewAttributeCriteriaErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		attr    SpanAttribute
+		wantErr string
+	}{
+		{name: "unknown operator", attr: SpanAttribute{Key: "k", Operator: "contains"}, wantErr: `unknown operator "contains"`},
+		{name: "in without values", attr: SpanAttribute{Key: "k", Operator: AttributeOperatorIn}, wantErr: "values are required for operator in"},
+		{name: "not in without values", attr: SpanAttribute{Key: "k", Operator: AttributeOperatorNotIn, Value: "v"}, wantErr: "values are required for operator not_in"},
+		{name: "gt not a number", attr: SpanAttribute{Key: "k", Operator: AttributeOperatorGt, Value: "ten"}, wantErr: `value "ten" of operator gt is not a number`},
+		{name: "lte without value", attr: SpanAttribute{Key: "k", Operator: AttributeOperatorLte}, wantErr: `value "" of operator lte is not a number`},
+		{name: "prefix without value", attr: SpanAttribute{Key: "k", Operator: AttributeOperatorPrefix}, wantErr: "value is required for operator prefix"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newAttributeCriteria(MatchTypeStrict, tt.attr)
+			require.Error(t, err)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSpanPredicates(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	span := ptrace.NewSpan()
+	span.SetKind(ptrace.SpanKindServer)
+	span.Status().SetCode(ptrace.StatusCodeError)
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	span.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(2 * time.Second)))
+
+	tests := []struct {
+		name      string
+		sc        SpanConfig
+		wantMatch bool
+	}{
+		{name: "span kind", sc: SpanConfig{SpanKind: "server"}, wantMatch: true},
+		{name: "other span kind", sc: SpanConfig{SpanKind: "client"}, wantMatch: false},
+		{name: "status code", sc: SpanConfig{StatusCode: "error"}, wantMatch: true},
+		{name: "other status code", sc: SpanConfig{StatusCode: "ok"}, wantMatch: false},
+		{name: "server errors", sc: SpanConfig{SpanKind: "server", StatusCode: "error"}, wantMatch: true},
+		{name: "min duration inclusive", sc: SpanConfig{MinDuration: 2 * time.Second}, wantMatch: true},
+		{name: "min duration", sc: SpanConfig{MinDuration: 3 * time.Second}, wantMatch: false},
+		{name: "max duration exclusive", sc: SpanConfig{MaxDuration: 2 * time.Second}, wantMatch: false},
+		{name: "max duration", sc: SpanConfig{MaxDuration: 3 * time.Second}, wantMatch: true},
+		{name: "duration range", sc: SpanConfig{MinDuration: time.Second, MaxDuration: 3 * time.Second}, wantMatch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantMatch, spanMatchesConfig(span, mustNewSpanCriteria(t, tt.sc)))
+		})
+	}
+}
+
+func TestSpanDuration(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	span := ptrace.NewSpan()
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	span.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(1500 * time.Millisecond)))
+	assert.Equal(t, 1500*time.Millisecond, spanDuration(span))
+
+	span.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(-time.Second)))
+	assert.Zero(t, spanDuration(span))
+}
@@ -0,0 +1,107 @@
+package tenantidprocessor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hypertrace/collector/processors/internal/filereloader"
+	"github.com/hypertrace/collector/processors/internal/headers"
+	internalmetadata "github.com/hypertrace/collector/processors/tenantidprocessor/internal/metadata"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const tagAPIKeyHash string = "api-key-hash"
+
+// apiKeySource maps an opaque API key header to a tenant ID using a reloadable mapping file.
+type apiKeySource struct {
+	headerName       string
+	tenantIDsByKey   atomic.Pointer[map[string]string]
+	reloader         *filereloader.Reloader
+	telemetryBuilder *internalmetadata.TelemetryBuilder
+}
+
+func newAPIKeySource(headerName string, cfg APIKeyConfig, logger *zap.Logger, telemetryBuilder *internalmetadata.TelemetryBuilder) *apiKeySource {
+	if headerName == "" {
+		headerName = defaultAPIKeyHeaderName
+	}
+	if cfg.ReloadInterval == 0 {
+		cfg.ReloadInterval = defaultAPIKeyReloadInterval
+	}
+
+	s := &apiKeySource{
+		headerName:       headerName,
+		telemetryBuilder: telemetryBuilder,
+	}
+	s.reloader = filereloader.New(cfg.MappingFile, cfg.ReloadInterval, s.loadMapping, logger)
+	return s
+}
+
+func (s *apiKeySource) name() string {
+	return string(TenantIDSourceAPIKey)
+}
+
+func (s *apiKeySource) start(context.Context) error {
+	return s.reloader.Start()
+}
+
+func (s *apiKeySource) shutdown(context.Context) error {
+	s.reloader.Shutdown()
+	return nil
+}
+
+func (s *apiKeySource) requestOnly() {}
+
+func (s *apiKeySource) resolve(ctx context.Context, _ pcommon.Map, _ attributeLookupFunc) (string, error) {
+	apiKeys, ok := headers.Get(ctx, s.headerName)
+	if !ok {
+		return "", fmt.Errorf("%w: could not extract headers from context", errTenantIDNotFound)
+	}
+	if len(apiKeys) == 0 {
+		return "", fmt.Errorf("%w: missing header: %s", errTenantIDNotFound, s.headerName)
+	} else if len(apiKeys) > 1 {
+		return "", fmt.Errorf("multiple %s headers were provided", s.headerName)
+	}
+
+	if tenantIDsByKey := s.tenantIDsByKey.Load(); tenantIDsByKey != nil {
+		if tenantID, ok := (*tenantIDsByKey)[apiKeys[0]]; ok {
+			return tenantID, nil
+		}
+	}
+
+	keyHash := hashAPIKey(apiKeys[0])
+	s.telemetryBuilder.ProcessorRejectedAPIKeys.Add(ctx, 1, metric.WithAttributes(attribute.KeyValue{
+		Key:   attribute.Key(tagAPIKeyHash),
+		Value: attribute.StringValue(keyHash),
+	}))
+	return "", fmt.Errorf("unknown API key, hash: %s", keyHash)
+}
+
+// loadMapping parses a YAML or JSON object of API key to tenant ID.
+func (s *apiKeySource) loadMapping(data []byte) error {
+	tenantIDsByKey := map[string]string{}
+	if err := yaml.Unmarshal(data, &tenantIDsByKey); err != nil {
+		return fmt.Errorf("invalid API key mapping: %w", err)
+	}
+	for key, tenantID := range tenantIDsByKey {
+		if key == "" || tenantID == "" {
+			return errors.New("API key mapping contains an empty key or tenant ID")
+		}
+	}
+	s.tenantIDsByKey.Store(&tenantIDsByKey)
+	return nil
+}
+
+// hashAPIKey returns a short, non reversible identifier of an API key
+// that is safe to log and use as a telemetry label.
+func hashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,88 @@
+package tenantidprocessor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+func apiKeyContext(apiKey string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{defaultAPIKeyHeaderName: apiKey}))
+}
+
+func TestAPIKeySource(t *testing.T) {
+	mappingFile := filepath.Join(t.TempDir(), "api-keys.yaml")
+	require.NoError(t, os.WriteFile(mappingFile, []byte("key-1: tenant1\nkey-2: tenant2\n"), 0600))
+
+	source := newAPIKeySource("", APIKeyConfig{MappingFile: mappingFile}, zap.NewNop(), createTelemetryBuilder(t))
+	require.NoError(t, source.start(context.Background()))
+	defer source.shutdown(context.Background())
+
+	tenantID, err := source.resolve(apiKeyContext("key-2"), pcommon.NewMap(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant2", tenantID)
+
+	_, err = source.resolve(apiKeyContext("key-3"), pcommon.NewMap(), nil)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errTenantIDNotFound)
+	assert.Contains(t, err.Error(), "unknown API key, hash: "+hashAPIKey("key-3"))
+	assert.NotContains(t, err.Error(), "key-3")
+
+	_, err = source.resolve(metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{})), pcommon.NewMap(), nil)
+	assert.ErrorIs(t, err, errTenantIDNotFound)
+}
+
+func TestAPIKeySourceJSONMapping(t *testing.T) {
+	mappingFile := filepath.Join(t.TempDir(), "api-keys.json")
+	require.NoError(t, os.WriteFile(mappingFile, []byte(`{"key-1": "tenant1"}`), 0600))
+
+	source := newAPIKeySource("x-key", APIKeyConfig{MappingFile: mappingFile}, zap.NewNop(), createTelemetryBuilder(t))
+	require.NoError(t, source.start(context.Background()))
+	defer source.shutdown(context.Background())
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"x-key": "key-1"}))
+	tenantID, err := source.resolve(ctx, pcommon.NewMap(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant1", tenantID)
+}
+
+func TestAPIKeySourceReloadsMapping(t *testing.T) {
+	mappingFile := filepath.Join(t.TempDir(), "api-keys.yaml")
+	require.NoError(t, os.WriteFile(mappingFile, []byte("key-1: tenant1\n"), 0600))
+
+	source := newAPIKeySource("", APIKeyConfig{MappingFile: mappingFile, ReloadInterval: 10 * time.Millisecond}, zap.NewNop(), createTelemetryBuilder(t))
+	require.NoError(t, source.start(context.Background()))
+	defer source.shutdown(context.Background())
+
+	// Rotate key-1 to key-2. An invalid file in between keeps the last good mapping.
+	require.NoError(t, os.WriteFile(mappingFile, []byte("key-1: [\n"), 0600))
+	require.NoError(t, os.Chtimes(mappingFile, time.Now(), time.Now().Add(time.Second)))
+	time.Sleep(50 * time.Millisecond)
+	tenantID, err := source.resolve(apiKeyContext("key-1"), pcommon.NewMap(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant1", tenantID)
+
+	require.NoError(t, os.WriteFile(mappingFile, []byte("key-2: tenant1\n"), 0600))
+	require.NoError(t, os.Chtimes(mappingFile, time.Now(), time.Now().Add(2*time.Second)))
+	assert.Eventually(t, func() bool {
+		_, err := source.resolve(apiKeyContext("key-1"), pcommon.NewMap(), nil)
+		tenantID, err2 := source.resolve(apiKeyContext("key-2"), pcommon.NewMap(), nil)
+		return err != nil && err2 == nil && tenantID == "tenant1"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestAPIKeySourceInvalidMapping(t *testing.T) {
+	mappingFile := filepath.Join(t.TempDir(), "api-keys.yaml")
+	require.NoError(t, os.WriteFile(mappingFile, []byte("key-1: \"\"\n"), 0600))
+
+	source := newAPIKeySource("", APIKeyConfig{MappingFile: mappingFile}, zap.NewNop(), createTelemetryBuilder(t))
+	assert.ErrorContains(t, source.start(context.Background()), "empty key or tenant ID")
+}
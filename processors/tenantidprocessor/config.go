@@ -1,5 +1,12 @@
 package tenantidprocessor
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
 // Config defines config for tenant ID processor.
 // The processor adds tenant ID attribute to every received span.
 // The processor returns an error when the tenant ID is missing.
@@ -11,4 +18,215 @@ type Config struct {
 	TenantIDHeaderName string `mapstructure:"header_name"`
 	// TenantIDAttributeKey defines span attribute key for tenant. Default tenant-id.
 	TenantIDAttributeKey string `mapstructure:"attribute_key"`
+	// TenantIDSources defines an ordered list of sources the tenant ID is resolved from.
+	// The first source that resolves wins. When empty, the tenant ID is read from
+	// the TenantIDHeaderName header only.
+	TenantIDSources []TenantIDSource `mapstructure:"sources"`
+	// Validation defines optional checks of the resolved tenant ID.
+	Validation ValidationConfig `mapstructure:"validation"`
+	// ConflictPolicy defines what happens when a resource already carries a different
+	// tenant ID in TenantIDAttributeKey. Default override.
+	ConflictPolicy ConflictPolicy `mapstructure:"conflict_policy"`
+	// UpstreamTenantIDAttributeKey defines the resource attribute key the existing tenant ID
+	// is moved to by the record_both policy. Default upstream-tenant-id.
+	UpstreamTenantIDAttributeKey string `mapstructure:"upstream_attribute_key"`
+	// Target defines where the tenant ID attribute is written to, one or more of
+	// resource, span, span_event, datapoint, log_record or all. Targets that don't
+	// apply to a signal are ignored. Default resource and datapoint.
+	Target []string `mapstructure:"target"`
+}
+
+const (
+	// TargetResource writes the tenant ID to resource attributes.
+	TargetResource = "resource"
+	// TargetSpan writes the tenant ID to the attributes of every span.
+	TargetSpan = "span"
+	// TargetSpanEvent writes the tenant ID to the attributes of every span event.
+	TargetSpanEvent = "span_event"
+	// TargetDataPoint writes the tenant ID to the attributes of every metric data point.
+	TargetDataPoint = "datapoint"
+	// TargetLogRecord writes the tenant ID to the attributes of every log record.
+	TargetLogRecord = "log_record"
+	// TargetAll writes the tenant ID everywhere.
+	TargetAll = "all"
+)
+
+// ConflictPolicy is how a resolved tenant ID is applied to a resource that
+// already carries a different one. The existing tenant ID is validated like
+// a resolved one before keep_existing or record_both apply it.
+type ConflictPolicy string
+
+const (
+	// ConflictPolicyOverride replaces the existing tenant ID.
+	ConflictPolicyOverride ConflictPolicy = "override"
+	// ConflictPolicyKeepExisting keeps the existing tenant ID.
+	ConflictPolicyKeepExisting ConflictPolicy = "keep_existing"
+	// ConflictPolicyReject fails the batch.
+	ConflictPolicyReject ConflictPolicy = "reject"
+	// ConflictPolicyRecordBoth replaces the existing tenant ID and keeps it
+	// in UpstreamTenantIDAttributeKey.
+	ConflictPolicyRecordBoth ConflictPolicy = "record_both"
+)
+
+// TenantIDSourceType is the kind of a tenant ID source.
+type TenantIDSourceType string
+
+const (
+	// TenantIDSourceHeader reads the tenant ID from the request header Key.
+	TenantIDSourceHeader TenantIDSourceType = "header"
+	// TenantIDSourceResourceAttribute reads the tenant ID from the resource attribute Key.
+	// Jaeger process tags are translated into resource attributes.
+	TenantIDSourceResourceAttribute TenantIDSourceType = "resource_attribute"
+	// TenantIDSourceSpanAttribute reads the tenant ID from the attribute Key of the
+	// first span of a resource that carries it. It only applies to traces.
+	TenantIDSourceSpanAttribute TenantIDSourceType = "span_attribute"
+	// TenantIDSourceJWT reads the tenant ID from a claim of the verified bearer
+	// token in the header Key. Default header is authorization.
+	TenantIDSourceJWT TenantIDSourceType = "jwt"
+	// TenantIDSourceAPIKey maps the API key in the header Key to a tenant ID
+	// using a mapping file. Default header is x-api-key.
+	TenantIDSourceAPIKey TenantIDSourceType = "api_key"
+	// TenantIDSourceDefault always resolves to the static Value.
+	TenantIDSourceDefault TenantIDSourceType = "default"
+)
+
+// TenantIDSource defines a single source of the tenant ID.
+type TenantIDSource struct {
+	// Type is one of header, resource_attribute, span_attribute, jwt, api_key or default.
+	Type TenantIDSourceType `mapstructure:"type"`
+	// Key is the header name or attribute key to read the tenant ID from.
+	Key string `mapstructure:"key"`
+	// Value is the static tenant ID used by the default source.
+	Value string `mapstructure:"value"`
+	// JWT configures token verification for the jwt source.
+	JWT JWTConfig `mapstructure:"jwt"`
+	// APIKey configures the mapping file for the api_key source.
+	APIKey APIKeyConfig `mapstructure:"api_key"`
+}
+
+// JWTConfig defines how bearer tokens are verified and which claim carries the tenant ID.
+// Tokens must be signed with one of the configured keys and must not be expired.
+type JWTConfig struct {
+	// Claim is the token claim holding the tenant ID.
+	Claim string `mapstructure:"claim"`
+	// KeysFile is a JWKS document or a PEM file of public keys and certificates.
+	KeysFile string `mapstructure:"keys_file"`
+	// ReloadInterval defines how often the keys file is checked for changes. Default 1m.
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+	// Issuer is the expected iss claim. Not checked when empty.
+	Issuer string `mapstructure:"issuer"`
+	// Audience is the expected aud claim. Not checked when empty.
+	Audience string `mapstructure:"audience"`
+}
+
+// APIKeyConfig defines where API keys are mapped to tenant IDs.
+// Requests with an API key missing from the mapping are rejected.
+type APIKeyConfig struct {
+	// MappingFile is a YAML or JSON object of API key to tenant ID.
+	MappingFile string `mapstructure:"mapping_file"`
+	// ReloadInterval defines how often the mapping file is checked for changes. Default 30s.
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+// ValidationAction is what happens to a batch whose tenant ID fails validation.
+type ValidationAction string
+
+const (
+	// ValidationActionReject fails the batch.
+	ValidationActionReject ValidationAction = "reject"
+	// ValidationActionQuarantine replaces the tenant ID with QuarantineTenantID.
+	ValidationActionQuarantine ValidationAction = "quarantine"
+)
+
+// ValidationConfig defines checks a resolved tenant ID has to pass.
+// All configured checks have to pass. Nothing is checked by default.
+type ValidationConfig struct {
+	// Pattern is a regular expression the tenant ID has to match, e.g. ^[a-z0-9-]+$.
+	Pattern string `mapstructure:"pattern"`
+	// MaxLength is the maximum length of the tenant ID in bytes. Not checked when 0.
+	MaxLength int `mapstructure:"max_length"`
+	// Allowlist is an inline list of accepted tenant IDs.
+	Allowlist []string `mapstructure:"allowlist"`
+	// AllowlistFile is a YAML or JSON list of accepted tenant IDs. It is merged with Allowlist.
+	AllowlistFile string `mapstructure:"allowlist_file"`
+	// AllowlistReloadInterval defines how often the allowlist file is checked for changes. Default 30s.
+	AllowlistReloadInterval time.Duration `mapstructure:"allowlist_reload_interval"`
+	// Action is either reject or quarantine. Default reject.
+	Action ValidationAction `mapstructure:"action"`
+	// QuarantineTenantID is the tenant ID used for invalid tenant IDs when Action is quarantine.
+	QuarantineTenantID string `mapstructure:"quarantine_tenant_id"`
+}
+
+func (cfg ValidationConfig) enabled() bool {
+	return cfg.Pattern != "" || cfg.MaxLength > 0 || len(cfg.Allowlist) > 0 || cfg.AllowlistFile != ""
+}
+
+// Validate checks the processor configuration is valid
+func (cfg *Config) Validate() error {
+	var errs error
+	for i, source := range cfg.TenantIDSources {
+		if err := source.validate(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("sources[%d]: %w", i, err))
+		}
+	}
+	if _, err := newStampTargets(cfg.Target); err != nil {
+		errs = errors.Join(errs, err)
+	}
+	switch cfg.ConflictPolicy {
+	case "", ConflictPolicyOverride, ConflictPolicyKeepExisting, ConflictPolicyReject, ConflictPolicyRecordBoth:
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown conflict_policy %q", cfg.ConflictPolicy))
+	}
+	if err := cfg.Validation.validate(); err != nil {
+		errs = errors.Join(errs, fmt.Errorf("validation: %w", err))
+	}
+	return errs
+}
+
+func (cfg ValidationConfig) validate() error {
+	if cfg.Pattern != "" {
+		if _, err := regexp.Compile(cfg.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if cfg.MaxLength < 0 {
+		return errors.New("max_length must not be negative")
+	}
+	switch cfg.Action {
+	case "", ValidationActionReject:
+	case ValidationActionQuarantine:
+		if cfg.QuarantineTenantID == "" {
+			return errors.New("quarantine_tenant_id is required for action \"quarantine\"")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", cfg.Action)
+	}
+	return nil
+}
+
+func (s TenantIDSource) validate() error {
+	switch s.Type {
+	case TenantIDSourceHeader, TenantIDSourceResourceAttribute, TenantIDSourceSpanAttribute:
+		if s.Key == "" {
+			return fmt.Errorf("key is required for source type %q", s.Type)
+		}
+	case TenantIDSourceJWT:
+		if s.JWT.Claim == "" {
+			return errors.New("jwt.claim is required for source type \"jwt\"")
+		}
+		if s.JWT.KeysFile == "" {
+			return errors.New("jwt.keys_file is required for source type \"jwt\"")
+		}
+	case TenantIDSourceAPIKey:
+		if s.APIKey.MappingFile == "" {
+			return errors.New("api_key.mapping_file is required for source type \"api_key\"")
+		}
+	case TenantIDSourceDefault:
+		if s.Value == "" {
+			return fmt.Errorf("value is required for source type %q", s.Type)
+		}
+	default:
+		return fmt.Errorf("unknown source type %q", s.Type)
+	}
+	return nil
 }
@@ -25,3 +25,129 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, "header-tenant", tIDcfg.TenantIDHeaderName)
 	assert.Equal(t, "attribute-tenant", tIDcfg.TenantIDAttributeKey)
 }
+
+func TestLoadConfigSources(t *testing.T) {
+	factories, err := otelcoltest.NopFactories()
+	assert.NoError(t, err)
+
+	factories.Processors[Type] = NewFactory()
+
+	cfg, err := otelcoltest.LoadConfig(path.Join(".", "testdata", "config.yml"), factories)
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	tIDcfg := cfg.Processors[component.NewIDWithName(Type, "sources")].(*Config)
+	assert.Equal(t, defaultHeaderName, tIDcfg.TenantIDHeaderName)
+	assert.Equal(t, []TenantIDSource{
+		{Type: TenantIDSourceHeader, Key: "x-tenant-id"},
+		{Type: TenantIDSourceResourceAttribute, Key: "tenant"},
+		{Type: TenantIDSourceSpanAttribute, Key: "tenant"},
+		{Type: TenantIDSourceDefault, Value: "default-tenant"},
+	}, tIDcfg.TenantIDSources)
+}
+
+func TestLoadConfigTarget(t *testing.T) {
+	factories, err := otelcoltest.NopFactories()
+	assert.NoError(t, err)
+
+	factories.Processors[Type] = NewFactory()
+
+	cfg, err := otelcoltest.LoadConfig(path.Join(".", "testdata", "config.yml"), factories)
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+	assert.Equal(t, []string{TargetAll}, cfg.Processors[component.NewIDWithName(Type, "all")].(*Config).Target)
+	assert.Equal(t, []string{TargetResource, TargetSpan}, cfg.Processors[component.NewIDWithName(Type, "targets")].(*Config).Target)
+	assert.Equal(t, []string{TargetResource, TargetDataPoint}, cfg.Processors[component.NewIDWithName(Type, "sources")].(*Config).Target)
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		sources        []TenantIDSource
+		validation     ValidationConfig
+		conflictPolicy ConflictPolicy
+		target         []string
+		wantErr        string
+	}{
+		{
+			name: "no sources",
+		},
+		{
+			name:    "unknown type",
+			sources: []TenantIDSource{{Type: "cookie", Key: "tenant"}},
+			wantErr: `unknown source type "cookie"`,
+		},
+		{
+			name:    "missing key",
+			sources: []TenantIDSource{{Type: TenantIDSourceResourceAttribute}},
+			wantErr: `key is required for source type "resource_attribute"`,
+		},
+		{
+			name:    "missing jwt claim",
+			sources: []TenantIDSource{{Type: TenantIDSourceJWT, JWT: JWTConfig{KeysFile: "jwks.json"}}},
+			wantErr: "jwt.claim is required",
+		},
+		{
+			name:    "missing jwt keys file",
+			sources: []TenantIDSource{{Type: TenantIDSourceJWT, JWT: JWTConfig{Claim: "tenant"}}},
+			wantErr: "jwt.keys_file is required",
+		},
+		{
+			name:    "missing api key mapping file",
+			sources: []TenantIDSource{{Type: TenantIDSourceAPIKey, Key: "x-api-key"}},
+			wantErr: "api_key.mapping_file is required",
+		},
+		{
+			name:    "missing default value",
+			sources: []TenantIDSource{{Type: TenantIDSourceHeader, Key: "x-tenant-id"}, {Type: TenantIDSourceDefault}},
+			wantErr: `sources[1]: value is required for source type "default"`,
+		},
+		{
+			name:           "unknown conflict policy",
+			conflictPolicy: "merge",
+			wantErr:        `unknown conflict_policy "merge"`,
+		},
+		{
+			name:    "unknown target",
+			target:  []string{TargetResource, "scope"},
+			wantErr: `unknown target "scope"`,
+		},
+		{
+			name:       "invalid pattern",
+			validation: ValidationConfig{Pattern: "[a-z"},
+			wantErr:    "validation: invalid pattern",
+		},
+		{
+			name:       "unknown action",
+			validation: ValidationConfig{MaxLength: 64, Action: "drop"},
+			wantErr:    `validation: unknown action "drop"`,
+		},
+		{
+			name:       "missing quarantine tenant ID",
+			validation: ValidationConfig{MaxLength: 64, Action: ValidationActionQuarantine},
+			wantErr:    "validation: quarantine_tenant_id is required",
+		},
+		{
+			name:       "quarantine",
+			validation: ValidationConfig{Pattern: "^[a-z]+$", Action: ValidationActionQuarantine, QuarantineTenantID: "quarantine"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createDefaultConfig().(*Config)
+			cfg.TenantIDSources = tt.sources
+			cfg.Validation = tt.validation
+			if tt.target != nil {
+				cfg.Target = tt.target
+			}
+			if tt.conflictPolicy != "" {
+				cfg.ConflictPolicy = tt.conflictPolicy
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package tenantidprocessor
 
 import (
 	"context"
+	"time"
 
 	"github.com/hypertrace/collector/processors/tenantidprocessor/internal/metadata"
 	"go.opentelemetry.io/collector/component"
@@ -12,8 +13,17 @@ import (
 )
 
 const (
-	defaultHeaderName   = "x-tenant-id"
-	defaultAttributeKey = "tenant-id"
+	defaultHeaderName                   = "x-tenant-id"
+	defaultAttributeKey                 = "tenant-id"
+	defaultUpstreamTenantIDAttributeKey = "upstream-tenant-id"
+
+	defaultJWTHeaderName     = "authorization"
+	defaultJWTReloadInterval = time.Minute
+
+	defaultAPIKeyHeaderName     = "x-api-key"
+	defaultAPIKeyReloadInterval = 30 * time.Second
+
+	defaultAllowlistReloadInterval = 30 * time.Second
 )
 
 var (
@@ -27,13 +37,17 @@ func NewFactory() processor.Factory {
 		createDefaultConfig,
 		processor.WithTraces(createTraceProcessor, component.StabilityLevelStable),
 		processor.WithMetrics(createMetricsProcessor, component.StabilityLevelStable),
+		processor.WithLogs(createLogsProcessor, component.StabilityLevelBeta),
 	)
 }
 
 func createDefaultConfig() component.Config {
 	return &Config{
-		TenantIDHeaderName:   defaultHeaderName,
-		TenantIDAttributeKey: defaultAttributeKey,
+		TenantIDHeaderName:           defaultHeaderName,
+		TenantIDAttributeKey:         defaultAttributeKey,
+		ConflictPolicy:               ConflictPolicyOverride,
+		UpstreamTenantIDAttributeKey: defaultUpstreamTenantIDAttributeKey,
+		Target:                       []string{TargetResource, TargetDataPoint},
 	}
 }
 
@@ -43,25 +57,19 @@ func createTraceProcessor(
 	cfg component.Config,
 	nextConsumer consumer.Traces,
 ) (processor.Traces, error) {
-	pCfg := cfg.(*Config)
-	// TelemetryBuilder will be used to setup metrics
-	telemetryBuilder, err := metadata.NewTelemetryBuilder(params.TelemetrySettings)
+	tenantProcessor, err := newTenantIdProcessor(params, cfg.(*Config))
 	if err != nil {
-		params.Logger.Error("error creating telemetry for the tenantidprocessor processor", zap.Error(err))
 		return nil, err
 	}
-	tenantProcessor := &tenantIdProcessor{
-		tenantIDAttributeKey: pCfg.TenantIDAttributeKey,
-		tenantIDHeaderName:   pCfg.TenantIDHeaderName,
-		logger:               params.Logger,
-		telemetryBuilder:     telemetryBuilder,
-	}
 	return processorhelper.NewTracesProcessor(
 		ctx,
 		params,
 		cfg,
 		nextConsumer,
-		tenantProcessor.ProcessTraces)
+		tenantProcessor.ProcessTraces,
+		processorhelper.WithStart(tenantProcessor.start),
+		processorhelper.WithShutdown(tenantProcessor.shutdown),
+	)
 }
 
 func createMetricsProcessor(
@@ -70,24 +78,62 @@ func createMetricsProcessor(
 	cfg component.Config,
 	nextConsumer consumer.Metrics,
 ) (processor.Metrics, error) {
-	pCfg := cfg.(*Config)
-	// TelemetryBuilder will be used to setup metrics
-	telemetryBuilder, err := metadata.NewTelemetryBuilder(params.TelemetrySettings)
+	tenantProcessor, err := newTenantIdProcessor(params, cfg.(*Config))
 	if err != nil {
-		params.Logger.Error("error creating telemetry for the tenantidprocessor processor", zap.Error(err))
 		return nil, err
 	}
-	tenantProcessor := &tenantIdProcessor{
-		tenantIDAttributeKey: pCfg.TenantIDAttributeKey,
-		tenantIDHeaderName:   pCfg.TenantIDHeaderName,
-		logger:               params.Logger,
-		telemetryBuilder:     telemetryBuilder,
-	}
 	return processorhelper.NewMetricsProcessor(
 		ctx,
 		params,
 		cfg,
 		nextConsumer,
 		tenantProcessor.ProcessMetrics,
+		processorhelper.WithStart(tenantProcessor.start),
+		processorhelper.WithShutdown(tenantProcessor.shutdown),
+	)
+}
+
+func createLogsProcessor(
+	ctx context.Context,
+	params processor.Settings,
+	cfg component.Config,
+	nextConsumer consumer.Logs,
+) (processor.Logs, error) {
+	tenantProcessor, err := newTenantIdProcessor(params, cfg.(*Config))
+	if err != nil {
+		return nil, err
+	}
+	return processorhelper.NewLogsProcessor(
+		ctx,
+		params,
+		cfg,
+		nextConsumer,
+		tenantProcessor.ProcessLogs,
+		processorhelper.WithStart(tenantProcessor.start),
+		processorhelper.WithShutdown(tenantProcessor.shutdown),
 	)
 }
+
+func newTenantIdProcessor(params processor.Settings, cfg *Config) (*tenantIdProcessor, error) {
+	// TelemetryBuilder will be used to setup metrics
+	telemetryBuilder, err := metadata.NewTelemetryBuilder(params.TelemetrySettings)
+	if err != nil {
+		params.Logger.Error("error creating telemetry for the tenantidprocessor processor", zap.Error(err))
+		return nil, err
+	}
+	targets, err := newStampTargets(cfg.Target)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantIdProcessor{
+		tenantIDAttributeKey:         cfg.TenantIDAttributeKey,
+		tenantIDHeaderName:           cfg.TenantIDHeaderName,
+		tenantIDSources:              newTenantIDSources(cfg, params.Logger, telemetryBuilder),
+		validator:                    newTenantIDValidator(cfg.Validation, params.Logger, telemetryBuilder),
+		conflictPolicy:               cfg.ConflictPolicy,
+		upstreamTenantIDAttributeKey: cfg.UpstreamTenantIDAttributeKey,
+		targets:                      targets,
+		logger:                       params.Logger,
+		telemetryBuilder:             telemetryBuilder,
+	}, nil
+}
@@ -1,13 +1,26 @@
 package tenantidprocessor
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/processor/processortest"
 )
 
 func TestCreateDefaultConfig(t *testing.T) {
 	cfg := createDefaultConfig().(*Config)
 	assert.Equal(t, defaultHeaderName, cfg.TenantIDHeaderName)
 	assert.Equal(t, defaultAttributeKey, cfg.TenantIDAttributeKey)
+	assert.Equal(t, ConflictPolicyOverride, cfg.ConflictPolicy)
+	assert.Equal(t, defaultUpstreamTenantIDAttributeKey, cfg.UpstreamTenantIDAttributeKey)
+}
+
+func TestCreateLogsProcessor(t *testing.T) {
+	factory := NewFactory()
+	lp, err := factory.CreateLogsProcessor(context.Background(), processortest.NewNopSettings(), factory.CreateDefaultConfig(), consumertest.NewNop())
+	require.NoError(t, err)
+	assert.NotNil(t, lp)
 }
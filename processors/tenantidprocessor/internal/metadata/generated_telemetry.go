@@ -30,9 +30,13 @@ func Tracer(settings component.TelemetrySettings) trace.Tracer {
 type TelemetryBuilder struct {
 	// In generated code but unused
 	// meter                     metric.Meter
-	ProcessorSpansPerTenant   metric.Int64Counter
-	ProcessorMetricsPerTenant metric.Int64Counter
-	meters                    map[configtelemetry.Level]metric.Meter
+	ProcessorSpansPerTenant    metric.Int64Counter
+	ProcessorMetricsPerTenant  metric.Int64Counter
+	ProcessorLogsPerTenant     metric.Int64Counter
+	ProcessorRejectedAPIKeys   metric.Int64Counter
+	ProcessorInvalidTenantIDs  metric.Int64Counter
+	ProcessorTenantIDConflicts metric.Int64Counter
+	meters                     map[configtelemetry.Level]metric.Meter
 }
 
 // TelemetryBuilderOption applies changes to default builder.
@@ -69,5 +73,29 @@ func NewTelemetryBuilder(settings component.TelemetrySettings, options ...Teleme
 		metric.WithUnit("{spans}"),
 	)
 	errs = errors.Join(errs, err)
+	builder.ProcessorLogsPerTenant, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_log_record_count",
+		metric.WithDescription("Number of log records received from a tenant"),
+		metric.WithUnit("{records}"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorRejectedAPIKeys, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_rejected_api_key_count",
+		metric.WithDescription("Number of resources rejected because of an unknown API key"),
+		metric.WithUnit("{resources}"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorInvalidTenantIDs, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_invalid_count",
+		metric.WithDescription("Number of resources with a tenant ID that failed validation"),
+		metric.WithUnit("{resources}"),
+	)
+	errs = errors.Join(errs, err)
+	builder.ProcessorTenantIDConflicts, err = builder.meters[configtelemetry.LevelBasic].Int64Counter(
+		"otelcol_tenant_id_conflict_count",
+		metric.WithDescription("Number of resources already carrying a different tenant ID"),
+		metric.WithUnit("{resources}"),
+	)
+	errs = errors.Join(errs, err)
 	return &builder, errs
 }
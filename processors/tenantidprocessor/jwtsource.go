@@ -0,0 +1,242 @@
+package tenantidprocessor
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hypertrace/collector/processors/internal/filereloader"
+	"github.com/hypertrace/collector/processors/internal/headers"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+)
+
+const bearerPrefix = "bearer "
+
+// jwtSource reads the tenant ID from a claim of a verified bearer token.
+type jwtSource struct {
+	headerName string
+	cfg        JWTConfig
+	keys       atomic.Pointer[jwt.VerificationKeySet]
+	keysByID   atomic.Pointer[map[string]jwt.VerificationKey]
+	reloader   *filereloader.Reloader
+	parser     *jwt.Parser
+}
+
+func newJWTSource(headerName string, cfg JWTConfig, logger *zap.Logger) *jwtSource {
+	if headerName == "" {
+		headerName = defaultJWTHeaderName
+	}
+	if cfg.ReloadInterval == 0 {
+		cfg.ReloadInterval = defaultJWTReloadInterval
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	s := &jwtSource{
+		headerName: headerName,
+		cfg:        cfg,
+		parser:     jwt.NewParser(opts...),
+	}
+	s.reloader = filereloader.New(cfg.KeysFile, cfg.ReloadInterval, s.loadKeys, logger)
+	return s
+}
+
+func (s *jwtSource) name() string {
+	return string(TenantIDSourceJWT)
+}
+
+func (s *jwtSource) start(context.Context) error {
+	return s.reloader.Start()
+}
+
+func (s *jwtSource) shutdown(context.Context) error {
+	s.reloader.Shutdown()
+	return nil
+}
+
+func (s *jwtSource) requestOnly() {}
+
+func (s *jwtSource) resolve(ctx context.Context, _ pcommon.Map, _ attributeLookupFunc) (string, error) {
+	values, ok := headers.Get(ctx, s.headerName)
+	if !ok {
+		return "", fmt.Errorf("%w: could not extract headers from context", errTenantIDNotFound)
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("%w: missing header: %s", errTenantIDNotFound, s.headerName)
+	} else if len(values) > 1 {
+		return "", fmt.Errorf("multiple %s headers were provided", s.headerName)
+	}
+
+	if len(values[0]) < len(bearerPrefix) || !strings.EqualFold(values[0][:len(bearerPrefix)], bearerPrefix) {
+		return "", fmt.Errorf("%w: %s header does not carry a bearer token", errTenantIDNotFound, s.headerName)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := s.parser.ParseWithClaims(strings.TrimSpace(values[0][len(bearerPrefix):]), claims, s.keyFunc); err != nil {
+		return "", fmt.Errorf("invalid bearer token: %w", err)
+	}
+
+	tenantID, ok := claims[s.cfg.Claim].(string)
+	if !ok || tenantID == "" {
+		return "", fmt.Errorf("bearer token is missing claim: %s", s.cfg.Claim)
+	}
+	return tenantID, nil
+}
+
+func (s *jwtSource) keyFunc(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if keysByID := s.keysByID.Load(); keysByID != nil {
+			if key, ok := (*keysByID)[kid]; ok {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+	keys := s.keys.Load()
+	if keys == nil {
+		return nil, errors.New("no verification keys loaded")
+	}
+	return *keys, nil
+}
+
+// loadKeys parses a JWKS document or a file of PEM encoded public keys and certificates.
+func (s *jwtSource) loadKeys(data []byte) error {
+	keysByID := map[string]jwt.VerificationKey{}
+	var keys []jwt.VerificationKey
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var jwks struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		if err := json.Unmarshal(trimmed, &jwks); err != nil {
+			return fmt.Errorf("invalid JWKS: %w", err)
+		}
+		for _, jwk := range jwks.Keys {
+			if jwk.Use != "" && jwk.Use != "sig" {
+				continue
+			}
+			key, err := jwk.publicKey()
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			if jwk.Kid != "" {
+				keysByID[jwk.Kid] = key
+			}
+		}
+	} else {
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			key, err := parsePEMPublicKey(block)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return errors.New("no verification keys found")
+	}
+	s.keys.Store(&jwt.VerificationKeySet{Keys: keys})
+	s.keysByID.Store(&keysByID)
+	return nil
+}
+
+func parsePEMPublicKey(block *pem.Block) (jwt.VerificationKey, error) {
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+// jsonWebKey is the subset of RFC 7517 needed to verify token signatures.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (jwt.VerificationKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus of key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent of key %q: %w", k.Kid, err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q of key %q", k.Crv, k.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate of key %q: %w", k.Kid, err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate of key %q: %w", k.Kid, err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q of key %q", k.Crv, k.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q of key %q", k.Kty, k.Kid)
+	}
+}
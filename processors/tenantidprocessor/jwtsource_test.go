@@ -0,0 +1,221 @@
+package tenantidprocessor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "hypertrace"
+	testKeyID    = "key-1"
+)
+
+func writeJWKS(t *testing.T, key *rsa.PublicKey, kid string) string {
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func bearerContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"authorization": "Bearer " + token}))
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    testIssuer,
+		"aud":    testAudience,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"tenant": testTenantID,
+	}
+}
+
+func TestJWTSource(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	source := newJWTSource("", JWTConfig{
+		Claim:    "tenant",
+		KeysFile: writeJWKS(t, &privateKey.PublicKey, testKeyID),
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	}, zap.NewNop())
+	require.NoError(t, source.start(context.Background()))
+	defer source.shutdown(context.Background())
+
+	expiredClaims := validClaims()
+	expiredClaims["exp"] = time.Now().Add(-time.Minute).Unix()
+	wrongIssuerClaims := validClaims()
+	wrongIssuerClaims["iss"] = "https://other.example.com"
+	wrongAudienceClaims := validClaims()
+	wrongAudienceClaims["aud"] = "other"
+	missingClaim := validClaims()
+	delete(missingClaim, "tenant")
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantTenantID string
+		wantNotFound bool
+		wantErr      string
+	}{
+		{
+			name:         "valid token",
+			ctx:          bearerContext(signToken(t, jwt.SigningMethodRS256, privateKey, testKeyID, validClaims())),
+			wantTenantID: testTenantID,
+		},
+		{
+			name:    "expired token",
+			ctx:     bearerContext(signToken(t, jwt.SigningMethodRS256, privateKey, testKeyID, expiredClaims)),
+			wantErr: "token is expired",
+		},
+		{
+			name:    "wrong issuer",
+			ctx:     bearerContext(signToken(t, jwt.SigningMethodRS256, privateKey, testKeyID, wrongIssuerClaims)),
+			wantErr: "token has invalid issuer",
+		},
+		{
+			name:    "wrong audience",
+			ctx:     bearerContext(signToken(t, jwt.SigningMethodRS256, privateKey, testKeyID, wrongAudienceClaims)),
+			wantErr: "token has invalid audience",
+		},
+		{
+			name:    "missing claim",
+			ctx:     bearerContext(signToken(t, jwt.SigningMethodRS256, privateKey, testKeyID, missingClaim)),
+			wantErr: "bearer token is missing claim: tenant",
+		},
+		{
+			name:    "unknown key id",
+			ctx:     bearerContext(signToken(t, jwt.SigningMethodRS256, privateKey, "key-2", validClaims())),
+			wantErr: "unknown key id: key-2",
+		},
+		{
+			name:    "wrong signing key",
+			ctx:     bearerContext(signToken(t, jwt.SigningMethodRS256, otherKey, "", validClaims())),
+			wantErr: "signature is invalid",
+		},
+		{
+			name:    "unsigned token",
+			ctx:     bearerContext(signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims())),
+			wantErr: "invalid bearer token",
+		},
+		{
+			name:         "missing header",
+			ctx:          metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{})),
+			wantNotFound: true,
+		},
+		{
+			name:         "not a bearer token",
+			ctx:          metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"authorization": "Basic Zm9vOmJhcg=="})),
+			wantNotFound: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantID, err := source.resolve(tt.ctx, pcommon.NewMap(), nil)
+			switch {
+			case tt.wantNotFound:
+				assert.ErrorIs(t, err, errTenantIDNotFound)
+			case tt.wantErr != "":
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, errTenantIDNotFound)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantTenantID, tenantID)
+			}
+		})
+	}
+}
+
+func TestJWTSourcePEMKeys(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	keysFile := filepath.Join(t.TempDir(), "keys.pem")
+	require.NoError(t, os.WriteFile(keysFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	source := newJWTSource("x-auth", JWTConfig{Claim: "tenant", KeysFile: keysFile}, zap.NewNop())
+	require.NoError(t, source.start(context.Background()))
+	defer source.shutdown(context.Background())
+
+	token := signToken(t, jwt.SigningMethodES256, privateKey, "", validClaims())
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"x-auth": "bearer " + token}))
+	tenantID, err := source.resolve(ctx, pcommon.NewMap(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, testTenantID, tenantID)
+}
+
+func TestJWTSourceReloadsKeys(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keysFile := writeJWKS(t, &oldKey.PublicKey, testKeyID)
+	source := newJWTSource("", JWTConfig{Claim: "tenant", KeysFile: keysFile, ReloadInterval: 10 * time.Millisecond}, zap.NewNop())
+	require.NoError(t, source.start(context.Background()))
+	defer source.shutdown(context.Background())
+
+	ctx := bearerContext(signToken(t, jwt.SigningMethodRS256, newKey, testKeyID, validClaims()))
+	_, err = source.resolve(ctx, pcommon.NewMap(), nil)
+	require.Error(t, err)
+
+	data, err := os.ReadFile(writeJWKS(t, &newKey.PublicKey, testKeyID))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keysFile, data, 0600))
+	require.NoError(t, os.Chtimes(keysFile, time.Now(), time.Now().Add(time.Second)))
+
+	assert.Eventually(t, func() bool {
+		tenantID, err := source.resolve(ctx, pcommon.NewMap(), nil)
+		return err == nil && tenantID == testTenantID
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestJWTSourceMissingKeysFile(t *testing.T) {
+	source := newJWTSource("", JWTConfig{Claim: "tenant", KeysFile: filepath.Join(t.TempDir(), "missing.json")}, zap.NewNop())
+	assert.Error(t, source.start(context.Background()))
+}
@@ -0,0 +1,48 @@
+package tenantidprocessor
+
+import "fmt"
+
+// stampTargets is the set of places the tenant ID attribute is written to.
+type stampTargets uint8
+
+const (
+	targetResource stampTargets = 1 << iota
+	targetSpan
+	targetSpanEvent
+	targetDataPoint
+	targetLogRecord
+
+	allStampTargets     = targetResource | targetSpan | targetSpanEvent | targetDataPoint | targetLogRecord
+	defaultStampTargets = targetResource | targetDataPoint
+)
+
+func newStampTargets(names []string) (stampTargets, error) {
+	if len(names) == 0 {
+		return defaultStampTargets, nil
+	}
+
+	var targets stampTargets
+	for _, name := range names {
+		switch name {
+		case TargetResource:
+			targets |= targetResource
+		case TargetSpan:
+			targets |= targetSpan
+		case TargetSpanEvent:
+			targets |= targetSpanEvent
+		case TargetDataPoint:
+			targets |= targetDataPoint
+		case TargetLogRecord:
+			targets |= targetLogRecord
+		case TargetAll:
+			targets |= allStampTargets
+		default:
+			return 0, fmt.Errorf("unknown target %q", name)
+		}
+	}
+	return targets, nil
+}
+
+func (t stampTargets) has(target stampTargets) bool {
+	return t&target != 0
+}
@@ -0,0 +1,143 @@
+package tenantidprocessor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	internalmetadata "github.com/hypertrace/collector/processors/tenantidprocessor/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+func newTargetsTestProcessor(tb testing.TB, target ...string) *tenantIdProcessor {
+	targets, err := newStampTargets(target)
+	require.NoError(tb, err)
+	telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(componenttest.NewNopTelemetrySettings())
+	require.NoError(tb, err)
+	return &tenantIdProcessor{
+		logger:               zap.NewNop(),
+		tenantIDHeaderName:   defaultHeaderName,
+		tenantIDAttributeKey: defaultAttributeKey,
+		targets:              targets,
+		telemetryBuilder:     telemetryBuilder,
+	}
+}
+
+func hasTenantAttr(attrs pcommon.Map) bool {
+	v, ok := attrs.Get(defaultAttributeKey)
+	return ok && v.Str() == testTenantID
+}
+
+func TestStampTargets(t *testing.T) {
+	tests := []struct {
+		target        []string
+		wantResource  bool
+		wantSpan      bool
+		wantSpanEvent bool
+		wantDataPoint bool
+		wantLogRecord bool
+	}{
+		{target: nil, wantResource: true, wantDataPoint: true},
+		{target: []string{TargetResource}, wantResource: true},
+		{target: []string{TargetSpan}, wantSpan: true},
+		{target: []string{TargetSpanEvent}, wantSpanEvent: true},
+		{target: []string{TargetDataPoint}, wantDataPoint: true},
+		{target: []string{TargetLogRecord}, wantLogRecord: true},
+		{target: []string{TargetResource, TargetSpan}, wantResource: true, wantSpan: true},
+		{target: []string{TargetAll}, wantResource: true, wantSpan: true, wantSpanEvent: true, wantDataPoint: true, wantLogRecord: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v", tt.target), func(t *testing.T) {
+			p := newTargetsTestProcessor(t, tt.target...)
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{defaultHeaderName: testTenantID}))
+
+			traces, err := p.ProcessTraces(ctx, generateTraceDataOneSpan())
+			require.NoError(t, err)
+			rs := traces.ResourceSpans().At(0)
+			span := rs.ScopeSpans().At(0).Spans().At(0)
+			assert.Equal(t, tt.wantResource, hasTenantAttr(rs.Resource().Attributes()))
+			assert.Equal(t, tt.wantSpan, hasTenantAttr(span.Attributes()))
+			for i := 0; i < span.Events().Len(); i++ {
+				assert.Equal(t, tt.wantSpanEvent, hasTenantAttr(span.Events().At(i).Attributes()))
+			}
+
+			metrics, err := p.ProcessMetrics(ctx, generateMetricData())
+			require.NoError(t, err)
+			rm := metrics.ResourceMetrics().At(0)
+			assert.Equal(t, tt.wantResource, hasTenantAttr(rm.Resource().Attributes()))
+			assert.Equal(t, tt.wantDataPoint, hasTenantAttr(rm.ScopeMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0).Attributes()))
+
+			logs := plog.NewLogs()
+			logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+			logs, err = p.ProcessLogs(ctx, logs)
+			require.NoError(t, err)
+			rl := logs.ResourceLogs().At(0)
+			assert.Equal(t, tt.wantResource, hasTenantAttr(rl.Resource().Attributes()))
+			assert.Equal(t, tt.wantLogRecord, hasTenantAttr(rl.ScopeLogs().At(0).LogRecords().At(0).Attributes()))
+		})
+	}
+}
+
+func TestNewStampTargetsUnknown(t *testing.T) {
+	_, err := newStampTargets([]string{"scope"})
+	assert.EqualError(t, err, `unknown target "scope"`)
+}
+
+func generateTraceDataManySpans(resources, spansPerResource int) ptrace.Traces {
+	td := ptrace.NewTraces()
+	for i := 0; i < resources; i++ {
+		rs := td.ResourceSpans().AppendEmpty()
+		initResource1(rs.Resource())
+		spans := rs.ScopeSpans().AppendEmpty().Spans()
+		for j := 0; j < spansPerResource; j++ {
+			fillSpanOne(spans.AppendEmpty())
+		}
+	}
+	return td
+}
+
+func BenchmarkProcessTracesTargets(b *testing.B) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{defaultHeaderName: testTenantID}))
+	for _, target := range [][]string{{TargetResource}, {TargetResource, TargetSpan}, {TargetAll}} {
+		b.Run(strings.Join(target, ","), func(b *testing.B) {
+			p := newTargetsTestProcessor(b, target...)
+			traces := generateTraceDataManySpans(10, 100)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.ProcessTraces(ctx, traces); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProcessMetricsTargets(b *testing.B) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{defaultHeaderName: testTenantID}))
+	for _, target := range [][]string{{TargetResource}, {TargetResource, TargetDataPoint}} {
+		b.Run(strings.Join(target, ","), func(b *testing.B) {
+			p := newTargetsTestProcessor(b, target...)
+			metrics := generateMetricData()
+			dps := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Sum().DataPoints()
+			for i := 0; i < 1000; i++ {
+				dps.AppendEmpty()
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.ProcessMetrics(ctx, metrics); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -2,49 +2,73 @@ package tenantidprocessor
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
 
 	internalmetadata "github.com/hypertrace/collector/processors/tenantidprocessor/internal/metadata"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
-	"google.golang.org/grpc/metadata"
 )
 
-const tagTenantID string = "tenant-id"
+const (
+	tagTenantID         string = "tenant-id"
+	tagTenantIDSource   string = "tenant-id-source"
+	tagUpstreamTenantID string = "upstream-tenant-id"
+	tagConflictPolicy   string = "conflict-policy"
+
+	// invalidUpstreamTenantID replaces rejected upstream tenant IDs in telemetry labels.
+	invalidUpstreamTenantID = "invalid"
+)
 
 type tenantIdProcessor struct {
-	tenantIDHeaderName   string
-	tenantIDAttributeKey string
-	logger               *zap.Logger
-	telemetryBuilder     *internalmetadata.TelemetryBuilder
+	tenantIDHeaderName           string
+	tenantIDAttributeKey         string
+	tenantIDSources              []tenantIDSource
+	validator                    *tenantIDValidator
+	conflictPolicy               ConflictPolicy
+	upstreamTenantIDAttributeKey string
+	targets                      stampTargets
+	logger                       *zap.Logger
+	telemetryBuilder             *internalmetadata.TelemetryBuilder
+}
+
+// resolvedTenantID is the tenant ID of a single resource and the source it was resolved from.
+type resolvedTenantID struct {
+	tenantID string
+	source   string
+	// upstreamTenantID is the conflicting tenant ID the resource carried, kept by record_both.
+	upstreamTenantID string
 }
 
 // ProcessMetrics implements processorhelper.ProcessMetricsFunc
 func (p *tenantIdProcessor) ProcessMetrics(ctx context.Context, metrics pmetric.Metrics) (pmetric.Metrics, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return metrics, fmt.Errorf("could not extract headers from context. Number of metrics: %d", metrics.MetricCount())
-	}
-
-	tenantIDHeaders := md.Get(p.tenantIDHeaderName)
-	if len(tenantIDHeaders) == 0 {
-		return metrics, fmt.Errorf("missing header: %s", p.tenantIDHeaderName)
-	} else if len(tenantIDHeaders) > 1 {
-		return metrics, fmt.Errorf("multiple tenant ID headers were provided, %s: %s", p.tenantIDHeaderName, strings.Join(tenantIDHeaders, ", "))
+	rms := metrics.ResourceMetrics()
+	resolved, err := p.resolveTenantIDs(ctx, rms.Len(), func(i int) (pcommon.Map, attributeLookupFunc) {
+		return rms.At(i).Resource().Attributes(), nil
+	})
+	if err != nil {
+		return metrics, fmt.Errorf("%w. Number of metrics: %d", err, metrics.MetricCount())
 	}
 
-	tenantID := tenantIDHeaders[0]
-	p.addTenantIdToMetrics(metrics, tenantID)
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		p.stampResource(rm.Resource().Attributes(), resolved[i])
+		if p.stampTargets().has(targetDataPoint) {
+			p.addTenantIdToMetrics(rm, resolved[i].tenantID)
+		}
 
-	tenantAttr := metric.WithAttributes(attribute.KeyValue{
-		Key:   attribute.Key(tagTenantID),
-		Value: attribute.StringValue(tenantID),
-	})
-	p.telemetryBuilder.ProcessorMetricsPerTenant.Add(ctx, int64(metrics.MetricCount()), tenantAttr)
+		metricCount := 0
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			metricCount += rm.ScopeMetrics().At(j).Metrics().Len()
+		}
+		p.telemetryBuilder.ProcessorMetricsPerTenant.Add(ctx, int64(metricCount), resolved[i].telemetryAttributes())
+	}
 
 	return metrics, nil
 
@@ -52,78 +76,280 @@ func (p *tenantIdProcessor) ProcessMetrics(ctx context.Context, metrics pmetric.
 
 // ProcessTraces implements processorhelper.ProcessTracesFunc
 func (p *tenantIdProcessor) ProcessTraces(ctx context.Context, traces ptrace.Traces) (ptrace.Traces, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return traces, fmt.Errorf("could not extract headers from context. Number of spans: %d", traces.SpanCount())
+	rss := traces.ResourceSpans()
+	resolved, err := p.resolveTenantIDs(ctx, rss.Len(), func(i int) (pcommon.Map, attributeLookupFunc) {
+		return rss.At(i).Resource().Attributes(), spanAttributeLookup(rss.At(i))
+	})
+	if err != nil {
+		return traces, fmt.Errorf("%w. Number of spans: %d", err, traces.SpanCount())
 	}
 
-	tenantIDHeaders := md.Get(p.tenantIDHeaderName)
-	if len(tenantIDHeaders) == 0 {
-		return traces, fmt.Errorf("missing header: %s", p.tenantIDHeaderName)
-	} else if len(tenantIDHeaders) > 1 {
-		return traces, fmt.Errorf("multiple tenant ID headers were provided, %s: %s", p.tenantIDHeaderName, strings.Join(tenantIDHeaders, ", "))
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		p.stampResource(rs.Resource().Attributes(), resolved[i])
+		spanCount := p.addTenantIdToSpans(rs, resolved[i].tenantID)
+		p.telemetryBuilder.ProcessorSpansPerTenant.Add(ctx, int64(spanCount), resolved[i].telemetryAttributes())
 	}
 
-	tenantID := tenantIDHeaders[0]
-	p.addTenantIdToSpans(traces, tenantID)
+	return traces, nil
+}
 
-	tenantAttr := metric.WithAttributes(attribute.KeyValue{
-		Key:   attribute.Key(tagTenantID),
-		Value: attribute.StringValue(tenantID),
+// ProcessLogs implements processorhelper.ProcessLogsFunc
+func (p *tenantIdProcessor) ProcessLogs(ctx context.Context, logs plog.Logs) (plog.Logs, error) {
+	rls := logs.ResourceLogs()
+	resolved, err := p.resolveTenantIDs(ctx, rls.Len(), func(i int) (pcommon.Map, attributeLookupFunc) {
+		return rls.At(i).Resource().Attributes(), nil
 	})
-	p.telemetryBuilder.ProcessorSpansPerTenant.Add(ctx, int64(traces.SpanCount()), tenantAttr)
+	if err != nil {
+		return logs, fmt.Errorf("%w. Number of log records: %d", err, logs.LogRecordCount())
+	}
 
-	return traces, nil
+	for i := 0; i < rls.Len(); i++ {
+		rl := rls.At(i)
+		p.stampResource(rl.Resource().Attributes(), resolved[i])
+		logRecordCount := p.addTenantIdToLogs(rl, resolved[i].tenantID)
+		p.telemetryBuilder.ProcessorLogsPerTenant.Add(ctx, int64(logRecordCount), resolved[i].telemetryAttributes())
+	}
+
+	return logs, nil
 }
 
-func (p *tenantIdProcessor) addTenantIdToSpans(traces ptrace.Traces, tenantIDHeaderValue string) {
-	rss := traces.ResourceSpans()
-	for i := 0; i < rss.Len(); i++ {
-		rs := rss.At(i)
-		rs.Resource().Attributes().PutStr(p.tenantIDAttributeKey, tenantIDHeaderValue)
+func (p *tenantIdProcessor) start(ctx context.Context, _ component.Host) error {
+	for _, source := range p.tenantIDSources {
+		if s, ok := source.(lifecycleSource); ok {
+			if err := s.start(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	if p.validator != nil {
+		return p.validator.start(ctx)
 	}
+	return nil
 }
 
-func (p *tenantIdProcessor) addTenantIdToMetrics(metrics pmetric.Metrics, tenantIDHeaderValue string) {
-	rms := metrics.ResourceMetrics()
-	for i := 0; i < rms.Len(); i++ {
-		rm := rms.At(i)
-		rm.Resource().Attributes().PutStr(p.tenantIDAttributeKey, tenantIDHeaderValue)
-		sms := rm.ScopeMetrics()
-		for j := 0; j < sms.Len(); j++ {
-			sm := sms.At(j)
-			metrics := sm.Metrics()
-			for k := 0; k < metrics.Len(); k++ {
-				metric := metrics.At(k)
-				metricDataType := metric.Type()
-				switch metricDataType {
-				case pmetric.MetricTypeEmpty:
-					p.logger.Error("Cannot add tenantId to metric. Metric Data type not present for metric: " + metric.Name())
-				case pmetric.MetricTypeGauge:
-					metricData := metric.Gauge().DataPoints()
-					for l := 0; l < metricData.Len(); l++ {
-						metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantIDHeaderValue)
-					}
-				case pmetric.MetricTypeSum:
-					metricData := metric.Sum().DataPoints()
-					for l := 0; l < metricData.Len(); l++ {
-						metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantIDHeaderValue)
-					}
-				case pmetric.MetricTypeHistogram:
-					metricData := metric.Histogram().DataPoints()
-					for l := 0; l < metricData.Len(); l++ {
-						metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantIDHeaderValue)
-					}
-				case pmetric.MetricTypeExponentialHistogram:
-					metricData := metric.ExponentialHistogram().DataPoints()
-					for l := 0; l < metricData.Len(); l++ {
-						metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantIDHeaderValue)
-					}
-				case pmetric.MetricTypeSummary:
-					metricData := metric.Summary().DataPoints()
-					for l := 0; l < metricData.Len(); l++ {
-						metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantIDHeaderValue)
-					}
+func (p *tenantIdProcessor) shutdown(ctx context.Context) error {
+	var errs error
+	for _, source := range p.tenantIDSources {
+		if s, ok := source.(lifecycleSource); ok {
+			errs = errors.Join(errs, s.shutdown(ctx))
+		}
+	}
+	if p.validator != nil {
+		errs = errors.Join(errs, p.validator.shutdown(ctx))
+	}
+	return errs
+}
+
+// resolveTenantIDs resolves the tenant ID of every resource in a batch before
+// anything is modified, so a failing resource rejects the whole batch untouched.
+// A batch without resources is still rejected when no tenant ID can be resolved.
+func (p *tenantIdProcessor) resolveTenantIDs(
+	ctx context.Context,
+	resourceCount int,
+	resourceAt func(i int) (pcommon.Map, attributeLookupFunc),
+) ([]resolvedTenantID, error) {
+	sources := p.tenantIDSources
+	if len(sources) == 0 {
+		sources = []tenantIDSource{&headerSource{headerName: p.tenantIDHeaderName}}
+	}
+	sources = batchSources(sources)
+
+	if resourceCount == 0 {
+		_, _, err := resolveTenantID(ctx, sources, pcommon.NewMap(), nil)
+		return nil, err
+	}
+
+	resolved := make([]resolvedTenantID, resourceCount)
+	for i := 0; i < resourceCount; i++ {
+		resourceAttrs, recordAttr := resourceAt(i)
+		tenantID, source, err := resolveTenantID(ctx, sources, resourceAttrs, recordAttr)
+		if err != nil {
+			return nil, err
+		}
+		if p.validator != nil {
+			if tenantID, err = p.validator.validate(ctx, tenantID); err != nil {
+				return nil, err
+			}
+		}
+		resolved[i] = resolvedTenantID{tenantID: tenantID, source: source}
+		if existing, ok := resourceAttrs.Get(p.tenantIDAttributeKey); ok && existing.AsString() != tenantID {
+			if resolved[i], err = p.resolveConflict(ctx, resolved[i], existing.AsString()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// resolveConflict applies the conflict policy to a resource that already carries
+// the existing tenant ID and counts the mismatch. The tenant ID kept by
+// keep_existing goes through the validator and its action.
+func (p *tenantIdProcessor) resolveConflict(ctx context.Context, resolved resolvedTenantID, existing string) (resolvedTenantID, error) {
+	policy := p.conflictPolicy
+	if policy == "" {
+		policy = ConflictPolicyOverride
+	}
+	// The existing tenant ID comes from upstream, so it is validated like a
+	// resolved one before it is used as a telemetry label or stamped.
+	upstreamTenantID, err := existing, error(nil)
+	if p.validator != nil {
+		upstreamTenantID, err = p.validator.validate(ctx, existing)
+	}
+	upstreamLabel := upstreamTenantID
+	if err != nil {
+		upstreamLabel = invalidUpstreamTenantID
+	}
+	p.telemetryBuilder.ProcessorTenantIDConflicts.Add(ctx, 1, metric.WithAttributes(
+		attribute.String(tagTenantID, resolved.tenantID),
+		attribute.String(tagUpstreamTenantID, upstreamLabel),
+		attribute.String(tagConflictPolicy, string(policy)),
+	))
+
+	switch policy {
+	case ConflictPolicyKeepExisting:
+		if err != nil {
+			return resolved, err
+		}
+		resolved.tenantID = upstreamTenantID
+	case ConflictPolicyReject:
+		return resolved, fmt.Errorf("resource tenant ID %q conflicts with resolved tenant ID %q", upstreamLabel, resolved.tenantID)
+	case ConflictPolicyRecordBoth:
+		if err != nil {
+			return resolved, err
+		}
+		resolved.upstreamTenantID = upstreamTenantID
+	}
+	return resolved, nil
+}
+
+func (p *tenantIdProcessor) stampTargets() stampTargets {
+	if p.targets == 0 {
+		return defaultStampTargets
+	}
+	return p.targets
+}
+
+// stampResource puts the resolved tenant ID on the resource attributes.
+func (p *tenantIdProcessor) stampResource(resourceAttrs pcommon.Map, resolved resolvedTenantID) {
+	if !p.stampTargets().has(targetResource) {
+		return
+	}
+	resourceAttrs.PutStr(p.tenantIDAttributeKey, resolved.tenantID)
+	if resolved.upstreamTenantID != "" {
+		resourceAttrs.PutStr(p.upstreamTenantIDAttributeKey, resolved.upstreamTenantID)
+	}
+}
+
+func (r resolvedTenantID) telemetryAttributes() metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String(tagTenantID, r.tenantID),
+		attribute.String(tagTenantIDSource, r.source),
+	)
+}
+
+// spanAttributeLookup returns the value of an attribute from the first span of
+// the resource that carries it.
+func spanAttributeLookup(rs ptrace.ResourceSpans) attributeLookupFunc {
+	return func(key string) (string, bool) {
+		sss := rs.ScopeSpans()
+		for i := 0; i < sss.Len(); i++ {
+			spans := sss.At(i).Spans()
+			for j := 0; j < spans.Len(); j++ {
+				if v, ok := spans.At(j).Attributes().Get(key); ok && v.AsString() != "" {
+					return v.AsString(), true
+				}
+			}
+		}
+		return "", false
+	}
+}
+
+// addTenantIdToSpans writes the tenant ID to spans and span events when targeted
+// and returns the number of spans of the resource.
+func (p *tenantIdProcessor) addTenantIdToSpans(rs ptrace.ResourceSpans, tenantID string) int {
+	targets := p.stampTargets()
+	stampSpans, stampEvents := targets.has(targetSpan), targets.has(targetSpanEvent)
+
+	spanCount := 0
+	sss := rs.ScopeSpans()
+	for i := 0; i < sss.Len(); i++ {
+		spans := sss.At(i).Spans()
+		spanCount += spans.Len()
+		if !stampSpans && !stampEvents {
+			continue
+		}
+		for j := 0; j < spans.Len(); j++ {
+			span := spans.At(j)
+			if stampSpans {
+				span.Attributes().PutStr(p.tenantIDAttributeKey, tenantID)
+			}
+			if stampEvents {
+				events := span.Events()
+				for k := 0; k < events.Len(); k++ {
+					events.At(k).Attributes().PutStr(p.tenantIDAttributeKey, tenantID)
+				}
+			}
+		}
+	}
+	return spanCount
+}
+
+// addTenantIdToLogs writes the tenant ID to log records when targeted and
+// returns the number of log records of the resource.
+func (p *tenantIdProcessor) addTenantIdToLogs(rl plog.ResourceLogs, tenantID string) int {
+	stampLogRecords := p.stampTargets().has(targetLogRecord)
+
+	logRecordCount := 0
+	sls := rl.ScopeLogs()
+	for i := 0; i < sls.Len(); i++ {
+		logRecords := sls.At(i).LogRecords()
+		logRecordCount += logRecords.Len()
+		if !stampLogRecords {
+			continue
+		}
+		for j := 0; j < logRecords.Len(); j++ {
+			logRecords.At(j).Attributes().PutStr(p.tenantIDAttributeKey, tenantID)
+		}
+	}
+	return logRecordCount
+}
+
+func (p *tenantIdProcessor) addTenantIdToMetrics(rm pmetric.ResourceMetrics, tenantID string) {
+	sms := rm.ScopeMetrics()
+	for j := 0; j < sms.Len(); j++ {
+		sm := sms.At(j)
+		metrics := sm.Metrics()
+		for k := 0; k < metrics.Len(); k++ {
+			metric := metrics.At(k)
+			metricDataType := metric.Type()
+			switch metricDataType {
+			case pmetric.MetricTypeEmpty:
+				p.logger.Error("Cannot add tenantId to metric. Metric Data type not present for metric: " + metric.Name())
+			case pmetric.MetricTypeGauge:
+				metricData := metric.Gauge().DataPoints()
+				for l := 0; l < metricData.Len(); l++ {
+					metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantID)
+				}
+			case pmetric.MetricTypeSum:
+				metricData := metric.Sum().DataPoints()
+				for l := 0; l < metricData.Len(); l++ {
+					metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantID)
+				}
+			case pmetric.MetricTypeHistogram:
+				metricData := metric.Histogram().DataPoints()
+				for l := 0; l < metricData.Len(); l++ {
+					metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantID)
+				}
+			case pmetric.MetricTypeExponentialHistogram:
+				metricData := metric.ExponentialHistogram().DataPoints()
+				for l := 0; l < metricData.Len(); l++ {
+					metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantID)
+				}
+			case pmetric.MetricTypeSummary:
+				metricData := metric.Summary().DataPoints()
+				for l := 0; l < metricData.Len(); l++ {
+					metricData.At(l).Attributes().PutStr(p.tenantIDAttributeKey, tenantID)
 				}
 			}
 		}
@@ -24,18 +24,26 @@ import (
 	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtelemetry"
 	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/consumer/consumertest"
 	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/exportertest"
 	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/collector/exporter/otlphttpexporter"
 	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/receiver"
 	"go.opentelemetry.io/collector/receiver/otlpreceiver"
 	"go.opentelemetry.io/collector/receiver/receivertest"
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -59,6 +67,10 @@ func TestMissingMetadataInContext(t *testing.T) {
 	_, err = p.ProcessMetrics(context.Background(), pmetric.NewMetrics())
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "could not extract headers")
+
+	_, err = p.ProcessLogs(context.Background(), plog.NewLogs())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not extract headers")
 }
 
 func TestMissingTenantHeader(t *testing.T) {
@@ -81,6 +93,10 @@ func TestMissingTenantHeader(t *testing.T) {
 	_, err = p.ProcessMetrics(ctx, pmetric.NewMetrics())
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "missing header")
+
+	_, err = p.ProcessLogs(ctx, plog.NewLogs())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing header")
 }
 
 func TestMultipleTenantHeaders(t *testing.T) {
@@ -104,6 +120,10 @@ func TestMultipleTenantHeaders(t *testing.T) {
 	_, err = p.ProcessMetrics(ctx, pmetric.NewMetrics())
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "multiple tenant ID headers")
+
+	_, err = p.ProcessLogs(ctx, plog.NewLogs())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "multiple tenant ID headers")
 }
 
 func TestEmptyTraces(t *testing.T) {
@@ -142,6 +162,51 @@ func TestEmptyMetrics(t *testing.T) {
 	assert.Equal(t, metrics, gotMetrics)
 }
 
+func TestEmptyLogs(t *testing.T) {
+	p := &tenantIdProcessor{
+		logger:               zap.NewNop(),
+		tenantIDHeaderName:   defaultHeaderName,
+		tenantIDAttributeKey: defaultHeaderName,
+		telemetryBuilder:     createTelemetryBuilder(t),
+	}
+	logs := plog.NewLogs()
+	md := metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID})
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		md,
+	)
+	gotLogs, err := p.ProcessLogs(ctx, logs)
+	require.NoError(t, err)
+	assert.Equal(t, logs, gotLogs)
+}
+
+func TestLogsTenantAttribute(t *testing.T) {
+	p := &tenantIdProcessor{
+		logger:               zap.NewNop(),
+		tenantIDHeaderName:   defaultHeaderName,
+		tenantIDAttributeKey: defaultAttributeKey,
+		telemetryBuilder:     createTelemetryBuilder(t),
+	}
+	logs := plog.NewLogs()
+	logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	md := metadata.New(map[string]string{p.tenantIDHeaderName: testTenantID})
+	ctx := metadata.NewIncomingContext(
+		context.Background(),
+		md,
+	)
+	gotLogs, err := p.ProcessLogs(ctx, logs)
+	require.NoError(t, err)
+
+	rls := gotLogs.ResourceLogs()
+	require.Equal(t, 2, rls.Len())
+	for i := 0; i < rls.Len(); i++ {
+		tenantAttr, ok := rls.At(i).Resource().Attributes().Get(defaultAttributeKey)
+		require.True(t, ok)
+		assert.Equal(t, testTenantID, tenantAttr.Str())
+	}
+}
+
 // GetAvailableLocalAddress finds an available local port and returns an endpoint
 // describing it. The port is available for opening when this function returns
 // provided that there is no race by some other code to grab the same port
@@ -234,6 +299,59 @@ func TestReceiveOTLPGRPC_Traces(t *testing.T) {
 	assert.Equal(t, reqTraces.ResourceSpans().Len(), tenantAttrsFound)
 }
 
+func TestReceiveOTLPHTTP_Traces(t *testing.T) {
+	tracesSink := new(consumertest.TracesSink)
+	tenantProcessor := &tenantIdProcessor{
+		logger:               zap.NewNop(),
+		tenantIDHeaderName:   defaultHeaderName,
+		tenantIDAttributeKey: defaultAttributeKey,
+		telemetryBuilder:     createTelemetryBuilder(t),
+	}
+
+	addr := getAvailableLocalAddress(t)
+	factory := otlpreceiver.NewFactory()
+	cfg := factory.CreateDefaultConfig().(*otlpreceiver.Config)
+	cfg.GRPC = nil
+	cfg.HTTP.ServerConfig.Endpoint = addr
+	cfg.HTTP.ServerConfig.IncludeMetadata = true
+	otlpTracesRec, err := factory.CreateTracesReceiver(context.Background(), receivertest.NewNopSettings(), cfg, tracesMultiConsumer{
+		tracesSink:      tracesSink,
+		tenantProcessor: tenantProcessor,
+	})
+	require.NoError(t, err)
+
+	err = otlpTracesRec.Start(context.Background(), componenttest.NewNopHost())
+	require.NoError(t, err)
+	defer otlpTracesRec.Shutdown(context.Background())
+
+	expFactory := otlphttpexporter.NewFactory()
+	expCfg := expFactory.CreateDefaultConfig().(*otlphttpexporter.Config)
+	expCfg.ClientConfig.Endpoint = "http://" + addr
+	expCfg.ClientConfig.Headers = map[string]configopaque.String{tenantProcessor.tenantIDHeaderName: testTenantID}
+	expCfg.RetryConfig.Enabled = false
+	expCfg.QueueConfig.Enabled = false
+	tracesExporter, err := expFactory.CreateTracesExporter(context.Background(), exportertest.NewNopSettings(), expCfg)
+	require.NoError(t, err)
+
+	err = tracesExporter.Start(context.Background(), componenttest.NewNopHost())
+	require.NoError(t, err)
+	defer tracesExporter.Shutdown(context.Background())
+
+	reqTraces := generateTraceDataOneSpan()
+	err = tracesExporter.ConsumeTraces(context.Background(), reqTraces)
+	require.NoError(t, err)
+
+	traces := tracesSink.AllTraces()
+	assert.Equal(t, 1, len(traces))
+	tenantAttrsFound := assertTenantAttributeExists(
+		t,
+		traces[0],
+		tenantProcessor.tenantIDAttributeKey,
+		testTenantID,
+	)
+	assert.Equal(t, reqTraces.ResourceSpans().Len(), tenantAttrsFound)
+}
+
 func createOTLPMetricsReceiver(t *testing.T, nextConsumer consumer.Metrics) (string, receiver.Metrics) {
 	addr := getAvailableLocalAddress(t)
 	factory := otlpreceiver.NewFactory()
@@ -593,3 +711,136 @@ func createTelemetryBuilder(t *testing.T) *internalmetadata.TelemetryBuilder {
 	require.NoError(t, err)
 	return telemetryBuilder
 }
+
+func TestConflictPolicy(t *testing.T) {
+	tests := []struct {
+		policy           ConflictPolicy
+		existingTenantID string
+		wantTenantID     string
+		wantUpstream     string
+		wantErr          string
+	}{
+		{policy: ConflictPolicyOverride, existingTenantID: "upstream", wantTenantID: testTenantID},
+		{policy: ConflictPolicyKeepExisting, existingTenantID: "upstream", wantTenantID: "upstream"},
+		{policy: ConflictPolicyReject, existingTenantID: "upstream", wantErr: `resource tenant ID "upstream" conflicts with resolved tenant ID "jdoe"`},
+		{policy: ConflictPolicyRecordBoth, existingTenantID: "upstream", wantTenantID: testTenantID, wantUpstream: "upstream"},
+		{policy: ConflictPolicyReject, existingTenantID: testTenantID, wantTenantID: testTenantID},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+"/"+tt.existingTenantID, func(t *testing.T) {
+			p := &tenantIdProcessor{
+				logger:                       zap.NewNop(),
+				tenantIDHeaderName:           defaultHeaderName,
+				tenantIDAttributeKey:         defaultAttributeKey,
+				conflictPolicy:               tt.policy,
+				upstreamTenantIDAttributeKey: defaultUpstreamTenantIDAttributeKey,
+				telemetryBuilder:             createTelemetryBuilder(t),
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{defaultHeaderName: testTenantID}))
+
+			traces := generateTraceDataOneSpan()
+			traces.ResourceSpans().At(0).Resource().Attributes().PutStr(defaultAttributeKey, tt.existingTenantID)
+			metrics := generateMetricData()
+			metrics.ResourceMetrics().At(0).Resource().Attributes().PutStr(defaultAttributeKey, tt.existingTenantID)
+
+			gotTraces, err := p.ProcessTraces(ctx, traces)
+			_, metricsErr := p.ProcessMetrics(ctx, metrics)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.ErrorContains(t, metricsErr, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, metricsErr)
+
+			attrs := gotTraces.ResourceSpans().At(0).Resource().Attributes()
+			tenantAttr, _ := attrs.Get(defaultAttributeKey)
+			assert.Equal(t, tt.wantTenantID, tenantAttr.Str())
+			upstreamAttr, ok := attrs.Get(defaultUpstreamTenantIDAttributeKey)
+			assert.Equal(t, tt.wantUpstream != "", ok)
+			assert.Equal(t, tt.wantUpstream, upstreamAttr.Str())
+			assert.Equal(t, 1, assertTenantTagExists(t, metrics, defaultAttributeKey, tt.wantTenantID))
+		})
+	}
+}
+
+func TestConflictPolicyUpstreamValidation(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           ConflictPolicy
+		action           ValidationAction
+		existingTenantID string
+		wantTenantID     string
+		wantUpstream     string
+		wantLabel        string
+		wantErr          string
+	}{
+		{name: "keep_existing/allowed", policy: ConflictPolicyKeepExisting, existingTenantID: "upstream", wantTenantID: "upstream", wantLabel: "upstream"},
+		{name: "keep_existing/reject", policy: ConflictPolicyKeepExisting, existingTenantID: "unknown", wantErr: "invalid tenant ID: failed allowlist validation", wantLabel: "invalid"},
+		{name: "keep_existing/quarantine", policy: ConflictPolicyKeepExisting, action: ValidationActionQuarantine, existingTenantID: "unknown", wantTenantID: "quarantine", wantLabel: "quarantine"},
+		{name: "record_both/allowed", policy: ConflictPolicyRecordBoth, existingTenantID: "upstream", wantTenantID: testTenantID, wantUpstream: "upstream", wantLabel: "upstream"},
+		{name: "record_both/reject", policy: ConflictPolicyRecordBoth, existingTenantID: "unknown", wantErr: "invalid tenant ID: failed allowlist validation", wantLabel: "invalid"},
+		{name: "record_both/quarantine", policy: ConflictPolicyRecordBoth, action: ValidationActionQuarantine, existingTenantID: "unknown", wantTenantID: testTenantID, wantUpstream: "quarantine", wantLabel: "quarantine"},
+		{name: "override/reject", policy: ConflictPolicyOverride, existingTenantID: "unknown", wantTenantID: testTenantID, wantLabel: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+			settings := componenttest.NewNopTelemetrySettings()
+			settings.MeterProvider = meterProvider
+			settings.LeveledMeterProvider = func(configtelemetry.Level) otelmetric.MeterProvider {
+				return meterProvider
+			}
+			telemetryBuilder, err := internalmetadata.NewTelemetryBuilder(settings)
+			require.NoError(t, err)
+			p := &tenantIdProcessor{
+				logger:                       zap.NewNop(),
+				tenantIDHeaderName:           defaultHeaderName,
+				tenantIDAttributeKey:         defaultAttributeKey,
+				conflictPolicy:               tt.policy,
+				upstreamTenantIDAttributeKey: defaultUpstreamTenantIDAttributeKey,
+				validator: newTenantIDValidator(ValidationConfig{
+					Allowlist:          []string{testTenantID, "upstream"},
+					Action:             tt.action,
+					QuarantineTenantID: "quarantine",
+				}, zap.NewNop(), telemetryBuilder),
+				telemetryBuilder: telemetryBuilder,
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{defaultHeaderName: testTenantID}))
+
+			traces := generateTraceDataOneSpan()
+			traces.ResourceSpans().At(0).Resource().Attributes().PutStr(defaultAttributeKey, tt.existingTenantID)
+
+			gotTraces, err := p.ProcessTraces(ctx, traces)
+
+			// The upstream tenant ID label is the validated one.
+			var rm metricdata.ResourceMetrics
+			require.NoError(t, reader.Collect(context.Background(), &rm))
+			var labels []string
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name != "otelcol_tenant_id_conflict_count" {
+						continue
+					}
+					for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+						label, _ := dp.Attributes.Value(attribute.Key(tagUpstreamTenantID))
+						labels = append(labels, label.AsString())
+					}
+				}
+			}
+			assert.Equal(t, []string{tt.wantLabel}, labels)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			attrs := gotTraces.ResourceSpans().At(0).Resource().Attributes()
+			tenantAttr, _ := attrs.Get(defaultAttributeKey)
+			assert.Equal(t, tt.wantTenantID, tenantAttr.Str())
+			upstreamAttr, _ := attrs.Get(defaultUpstreamTenantIDAttributeKey)
+			assert.Equal(t, tt.wantUpstream, upstreamAttr.Str())
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package tenantidprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hypertrace/collector/processors/internal/headers"
+	internalmetadata "github.com/hypertrace/collector/processors/tenantidprocessor/internal/metadata"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+)
+
+// errTenantIDNotFound is returned by a source that could not resolve the tenant ID.
+// The next source in the chain is tried in that case, any other error stops the chain.
+var errTenantIDNotFound = errors.New("tenant ID not found")
+
+// attributeLookupFunc looks up an attribute on the records (e.g. spans) of a resource.
+type attributeLookupFunc func(key string) (string, bool)
+
+// tenantIDSource resolves the tenant ID of a single resource.
+type tenantIDSource interface {
+	// name identifies the source in telemetry.
+	name() string
+	// resolve returns the tenant ID or an error wrapping errTenantIDNotFound when
+	// the source does not apply to the resource.
+	resolve(ctx context.Context, resourceAttrs pcommon.Map, recordAttr attributeLookupFunc) (string, error)
+}
+
+// lifecycleSource is implemented by sources that hold state, like reloadable files.
+type lifecycleSource interface {
+	start(ctx context.Context) error
+	shutdown(ctx context.Context) error
+}
+
+// requestSource is implemented by sources that only read the request, like its
+// headers. They resolve the same tenant ID for every resource of a batch.
+type requestSource interface {
+	tenantIDSource
+	requestOnly()
+}
+
+// batchSources returns the sources to resolve the resources of a batch with.
+// Request sources are wrapped so they resolve once per batch, which matters
+// for sources doing expensive work, like verifying token signatures.
+func batchSources(sources []tenantIDSource) []tenantIDSource {
+	var batch []tenantIDSource
+	for i, source := range sources {
+		if _, ok := source.(requestSource); !ok {
+			continue
+		}
+		if batch == nil {
+			batch = slices.Clone(sources)
+		}
+		batch[i] = &onceSource{tenantIDSource: source}
+	}
+	if batch == nil {
+		return sources
+	}
+	return batch
+}
+
+// onceSource remembers the result of the first resolve of a request source.
+type onceSource struct {
+	tenantIDSource
+	resolved bool
+	tenantID string
+	err      error
+}
+
+func (s *onceSource) resolve(ctx context.Context, resourceAttrs pcommon.Map, recordAttr attributeLookupFunc) (string, error) {
+	if !s.resolved {
+		s.tenantID, s.err = s.tenantIDSource.resolve(ctx, resourceAttrs, recordAttr)
+		s.resolved = true
+	}
+	return s.tenantID, s.err
+}
+
+func newTenantIDSources(cfg *Config, logger *zap.Logger, telemetryBuilder *internalmetadata.TelemetryBuilder) []tenantIDSource {
+	if len(cfg.TenantIDSources) == 0 {
+		return []tenantIDSource{&headerSource{headerName: cfg.TenantIDHeaderName}}
+	}
+
+	sources := make([]tenantIDSource, 0, len(cfg.TenantIDSources))
+	for _, s := range cfg.TenantIDSources {
+		switch s.Type {
+		case TenantIDSourceHeader:
+			sources = append(sources, &headerSource{headerName: s.Key})
+		case TenantIDSourceResourceAttribute:
+			sources = append(sources, &resourceAttributeSource{key: s.Key})
+		case TenantIDSourceSpanAttribute:
+			sources = append(sources, &spanAttributeSource{key: s.Key})
+		case TenantIDSourceJWT:
+			sources = append(sources, newJWTSource(s.Key, s.JWT, logger))
+		case TenantIDSourceAPIKey:
+			sources = append(sources, newAPIKeySource(s.Key, s.APIKey, logger, telemetryBuilder))
+		case TenantIDSourceDefault:
+			sources = append(sources, &defaultSource{tenantID: s.Value})
+		}
+	}
+	return sources
+}
+
+// resolveTenantID walks the sources in order and returns the first resolved
+// tenant ID together with the name of the source that resolved it.
+func resolveTenantID(
+	ctx context.Context,
+	sources []tenantIDSource,
+	resourceAttrs pcommon.Map,
+	recordAttr attributeLookupFunc,
+) (string, string, error) {
+	var notFoundErrs error
+	for _, source := range sources {
+		tenantID, err := source.resolve(ctx, resourceAttrs, recordAttr)
+		if err == nil {
+			return tenantID, source.name(), nil
+		}
+		if !errors.Is(err, errTenantIDNotFound) {
+			return "", "", err
+		}
+		notFoundErrs = errors.Join(notFoundErrs, err)
+	}
+	return "", "", notFoundErrs
+}
+
+type headerSource struct {
+	headerName string
+}
+
+func (s *headerSource) name() string {
+	return string(TenantIDSourceHeader)
+}
+
+func (s *headerSource) requestOnly() {}
+
+func (s *headerSource) resolve(ctx context.Context, _ pcommon.Map, _ attributeLookupFunc) (string, error) {
+	tenantIDHeaders, ok := headers.Get(ctx, s.headerName)
+	if !ok {
+		return "", fmt.Errorf("%w: could not extract headers from context", errTenantIDNotFound)
+	}
+	if len(tenantIDHeaders) == 0 {
+		return "", fmt.Errorf("%w: missing header: %s", errTenantIDNotFound, s.headerName)
+	} else if len(tenantIDHeaders) > 1 {
+		return "", fmt.Errorf("multiple tenant ID headers were provided, %s: %s", s.headerName, strings.Join(tenantIDHeaders, ", "))
+	}
+
+	return tenantIDHeaders[0], nil
+}
+
+type resourceAttributeSource struct {
+	key string
+}
+
+func (s *resourceAttributeSource) name() string {
+	return string(TenantIDSourceResourceAttribute)
+}
+
+func (s *resourceAttributeSource) resolve(_ context.Context, resourceAttrs pcommon.Map, _ attributeLookupFunc) (string, error) {
+	if v, ok := resourceAttrs.Get(s.key); ok && v.AsString() != "" {
+		return v.AsString(), nil
+	}
+	return "", fmt.Errorf("%w: missing resource attribute: %s", errTenantIDNotFound, s.key)
+}
+
+type spanAttributeSource struct {
+	key string
+}
+
+func (s *spanAttributeSource) name() string {
+	return string(TenantIDSourceSpanAttribute)
+}
+
+func (s *spanAttributeSource) resolve(_ context.Context, _ pcommon.Map, recordAttr attributeLookupFunc) (string, error) {
+	if recordAttr != nil {
+		if tenantID, ok := recordAttr(s.key); ok {
+			return tenantID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: missing span attribute: %s", errTenantIDNotFound, s.key)
+}
+
+type defaultSource struct {
+	tenantID string
+}
+
+func (s *defaultSource) name() string {
+	return string(TenantIDSourceDefault)
+}
+
+func (s *defaultSource) resolve(_ context.Context, _ pcommon.Map, _ attributeLookupFunc) (string, error) {
+	return s.tenantID, nil
+}
@@ -0,0 +1,201 @@
+package tenantidprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hypertrace/collector/processors/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestResolveTenantIDSources(t *testing.T) {
+	sources := newTenantIDSources(&Config{
+		TenantIDSources: []TenantIDSource{
+			{Type: TenantIDSourceHeader, Key: defaultHeaderName},
+			{Type: TenantIDSourceResourceAttribute, Key: "tenant"},
+			{Type: TenantIDSourceSpanAttribute, Key: "tenant"},
+			{Type: TenantIDSourceDefault, Value: "default-tenant"},
+		},
+	}, zap.NewNop(), createTelemetryBuilder(t))
+	headerCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{defaultHeaderName: testTenantID}))
+	spanAttr := func(key string) (string, bool) {
+		if key == "tenant" {
+			return "span-tenant", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		resourceAttrs map[string]string
+		recordAttr    attributeLookupFunc
+		wantTenantID  string
+		wantSource    string
+	}{
+		{
+			name:          "header wins",
+			ctx:           headerCtx,
+			resourceAttrs: map[string]string{"tenant": "resource-tenant"},
+			recordAttr:    spanAttr,
+			wantTenantID:  testTenantID,
+			wantSource:    "header",
+		},
+		{
+			name:          "resource attribute",
+			ctx:           context.Background(),
+			resourceAttrs: map[string]string{"tenant": "resource-tenant"},
+			recordAttr:    spanAttr,
+			wantTenantID:  "resource-tenant",
+			wantSource:    "resource_attribute",
+		},
+		{
+			name:         "span attribute",
+			ctx:          context.Background(),
+			recordAttr:   spanAttr,
+			wantTenantID: "span-tenant",
+			wantSource:   "span_attribute",
+		},
+		{
+			name:         "default",
+			ctx:          context.Background(),
+			wantTenantID: "default-tenant",
+			wantSource:   "default",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantID, source, err := resolveTenantID(tt.ctx, sources, testutil.NewAttributeMapFromStringMap(tt.resourceAttrs), tt.recordAttr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTenantID, tenantID)
+			assert.Equal(t, tt.wantSource, source)
+		})
+	}
+}
+
+func TestResolveTenantIDNotFound(t *testing.T) {
+	sources := newTenantIDSources(&Config{
+		TenantIDSources: []TenantIDSource{
+			{Type: TenantIDSourceHeader, Key: defaultHeaderName},
+			{Type: TenantIDSourceResourceAttribute, Key: "tenant"},
+		},
+	}, zap.NewNop(), createTelemetryBuilder(t))
+	_, _, err := resolveTenantID(context.Background(), sources, pcommon.NewMap(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not extract headers")
+	assert.Contains(t, err.Error(), "missing resource attribute: tenant")
+}
+
+func TestResolveTenantIDMultipleHeadersStopsChain(t *testing.T) {
+	sources := newTenantIDSources(&Config{
+		TenantIDSources: []TenantIDSource{
+			{Type: TenantIDSourceHeader, Key: defaultHeaderName},
+			{Type: TenantIDSourceDefault, Value: "default-tenant"},
+		},
+	}, zap.NewNop(), createTelemetryBuilder(t))
+	md := metadata.New(map[string]string{defaultHeaderName: testTenantID})
+	md.Append(defaultHeaderName, "jdoe2")
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	_, _, err := resolveTenantID(ctx, sources, pcommon.NewMap(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "multiple tenant ID headers")
+}
+
+func TestProcessTracesPerResourceTenantID(t *testing.T) {
+	p := &tenantIdProcessor{
+		logger:               zap.NewNop(),
+		tenantIDAttributeKey: defaultAttributeKey,
+		tenantIDSources: newTenantIDSources(&Config{
+			TenantIDSources: []TenantIDSource{
+				{Type: TenantIDSourceResourceAttribute, Key: "jaeger.tenant"},
+				{Type: TenantIDSourceSpanAttribute, Key: "tenant"},
+			},
+		}, zap.NewNop(), createTelemetryBuilder(t)),
+		telemetryBuilder: createTelemetryBuilder(t),
+	}
+
+	traces := ptrace.NewTraces()
+	testutil.NewTestTraces(testutil.NewTestSpan()).ResourceSpans().At(0).CopyTo(traces.ResourceSpans().AppendEmpty())
+	traces.ResourceSpans().At(0).Resource().Attributes().PutStr("jaeger.tenant", "tenant1")
+	testutil.NewTestTraces(testutil.NewTestSpan("tenant", "tenant2")).ResourceSpans().At(0).CopyTo(traces.ResourceSpans().AppendEmpty())
+
+	gotTraces, err := p.ProcessTraces(context.Background(), traces)
+	require.NoError(t, err)
+	tenant1, _ := gotTraces.ResourceSpans().At(0).Resource().Attributes().Get(defaultAttributeKey)
+	assert.Equal(t, "tenant1", tenant1.Str())
+	tenant2, _ := gotTraces.ResourceSpans().At(1).Resource().Attributes().Get(defaultAttributeKey)
+	assert.Equal(t, "tenant2", tenant2.Str())
+}
+
+func TestProcessTracesUnresolvedResourceRejectsBatch(t *testing.T) {
+	p := &tenantIdProcessor{
+		logger:               zap.NewNop(),
+		tenantIDAttributeKey: defaultAttributeKey,
+		tenantIDSources: newTenantIDSources(&Config{
+			TenantIDSources: []TenantIDSource{
+				{Type: TenantIDSourceSpanAttribute, Key: "tenant"},
+			},
+		}, zap.NewNop(), createTelemetryBuilder(t)),
+		telemetryBuilder: createTelemetryBuilder(t),
+	}
+
+	traces := ptrace.NewTraces()
+	testutil.NewTestTraces(testutil.NewTestSpan("tenant", "tenant1")).ResourceSpans().At(0).CopyTo(traces.ResourceSpans().AppendEmpty())
+	testutil.NewTestTraces(testutil.NewTestSpan()).ResourceSpans().At(0).CopyTo(traces.ResourceSpans().AppendEmpty())
+
+	_, err := p.ProcessTraces(context.Background(), traces)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing span attribute: tenant")
+	_, ok := traces.ResourceSpans().At(0).Resource().Attributes().Get(defaultAttributeKey)
+	assert.False(t, ok)
+}
+
+// countingSource counts its resolves and resolves a fixed tenant ID.
+type countingSource struct {
+	tenantID string
+	resolves int
+}
+
+func (s *countingSource) name() string {
+	return "counting"
+}
+
+func (s *countingSource) resolve(context.Context, pcommon.Map, attributeLookupFunc) (string, error) {
+	s.resolves++
+	return s.tenantID, nil
+}
+
+type countingRequestSource struct {
+	countingSource
+}
+
+func (s *countingRequestSource) requestOnly() {}
+
+func TestProcessTracesResolvesRequestSourcesOncePerBatch(t *testing.T) {
+	resourceSource := &countingSource{tenantID: "tenant1"}
+	requestSource := &countingRequestSource{countingSource{tenantID: "tenant1"}}
+	traces := ptrace.NewTraces()
+	for i := 0; i < 3; i++ {
+		testutil.NewTestTraces(testutil.NewTestSpan()).ResourceSpans().At(0).CopyTo(traces.ResourceSpans().AppendEmpty())
+	}
+
+	for _, sources := range [][]tenantIDSource{{requestSource}, {resourceSource}} {
+		p := &tenantIdProcessor{
+			logger:               zap.NewNop(),
+			tenantIDAttributeKey: defaultAttributeKey,
+			tenantIDSources:      sources,
+			telemetryBuilder:     createTelemetryBuilder(t),
+		}
+		_, err := p.ProcessTraces(context.Background(), traces)
+		require.NoError(t, err)
+		_, err = p.ProcessTraces(context.Background(), traces)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, requestSource.resolves)
+	assert.Equal(t, 6, resourceSource.resolves)
+}
@@ -0,0 +1,138 @@
+package tenantidprocessor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/hypertrace/collector/processors/internal/filereloader"
+	internalmetadata "github.com/hypertrace/collector/processors/tenantidprocessor/internal/metadata"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	tagValidationReason string = "reason"
+	tagValidationAction string = "action"
+)
+
+// tenantIDValidator checks resolved tenant IDs before they are stamped on
+// resources and used as telemetry labels.
+type tenantIDValidator struct {
+	pattern            *regexp.Regexp
+	maxLength          int
+	inlineAllowlist    map[string]struct{}
+	fileAllowlist      atomic.Pointer[map[string]struct{}]
+	reloader           *filereloader.Reloader
+	action             ValidationAction
+	quarantineTenantID string
+	telemetryBuilder   *internalmetadata.TelemetryBuilder
+}
+
+// newTenantIDValidator returns nil when no validation is configured.
+func newTenantIDValidator(cfg ValidationConfig, logger *zap.Logger, telemetryBuilder *internalmetadata.TelemetryBuilder) *tenantIDValidator {
+	if !cfg.enabled() {
+		return nil
+	}
+
+	v := &tenantIDValidator{
+		maxLength:          cfg.MaxLength,
+		action:             cfg.Action,
+		quarantineTenantID: cfg.QuarantineTenantID,
+		telemetryBuilder:   telemetryBuilder,
+	}
+	if v.action == "" {
+		v.action = ValidationActionReject
+	}
+	if cfg.Pattern != "" {
+		// Validate already rejected patterns that don't compile.
+		v.pattern = regexp.MustCompile(cfg.Pattern)
+	}
+	if len(cfg.Allowlist) > 0 {
+		v.inlineAllowlist = make(map[string]struct{}, len(cfg.Allowlist))
+		for _, tenantID := range cfg.Allowlist {
+			v.inlineAllowlist[tenantID] = struct{}{}
+		}
+	}
+	if cfg.AllowlistFile != "" {
+		reloadInterval := cfg.AllowlistReloadInterval
+		if reloadInterval == 0 {
+			reloadInterval = defaultAllowlistReloadInterval
+		}
+		v.reloader = filereloader.New(cfg.AllowlistFile, reloadInterval, v.loadAllowlist, logger)
+	}
+	return v
+}
+
+func (v *tenantIDValidator) start(context.Context) error {
+	if v.reloader != nil {
+		return v.reloader.Start()
+	}
+	return nil
+}
+
+func (v *tenantIDValidator) shutdown(context.Context) error {
+	if v.reloader != nil {
+		v.reloader.Shutdown()
+	}
+	return nil
+}
+
+// validate returns the tenant ID to use, which is the quarantine tenant ID
+// for invalid tenant IDs when configured so, or an error when the tenant ID
+// has to be rejected.
+func (v *tenantIDValidator) validate(ctx context.Context, tenantID string) (string, error) {
+	reason := v.check(tenantID)
+	if reason == "" {
+		return tenantID, nil
+	}
+
+	v.telemetryBuilder.ProcessorInvalidTenantIDs.Add(ctx, 1, metric.WithAttributes(
+		attribute.String(tagValidationReason, reason),
+		attribute.String(tagValidationAction, string(v.action)),
+	))
+	if v.action == ValidationActionQuarantine {
+		return v.quarantineTenantID, nil
+	}
+	// The tenant ID is not echoed back, it can be arbitrarily large.
+	return "", fmt.Errorf("invalid tenant ID: failed %s validation", reason)
+}
+
+// check returns the name of the first failed check or an empty string.
+func (v *tenantIDValidator) check(tenantID string) string {
+	if v.maxLength > 0 && len(tenantID) > v.maxLength {
+		return "max_length"
+	}
+	if v.pattern != nil && !v.pattern.MatchString(tenantID) {
+		return "pattern"
+	}
+	if v.inlineAllowlist == nil && v.reloader == nil {
+		return ""
+	}
+	if _, ok := v.inlineAllowlist[tenantID]; ok {
+		return ""
+	}
+	if fileAllowlist := v.fileAllowlist.Load(); fileAllowlist != nil {
+		if _, ok := (*fileAllowlist)[tenantID]; ok {
+			return ""
+		}
+	}
+	return "allowlist"
+}
+
+// loadAllowlist parses a YAML or JSON list of tenant IDs.
+func (v *tenantIDValidator) loadAllowlist(data []byte) error {
+	var tenantIDs []string
+	if err := yaml.Unmarshal(data, &tenantIDs); err != nil {
+		return fmt.Errorf("invalid allowlist: %w", err)
+	}
+	allowlist := make(map[string]struct{}, len(tenantIDs))
+	for _, tenantID := range tenantIDs {
+		allowlist[tenantID] = struct{}{}
+	}
+	v.fileAllowlist.Store(&allowlist)
+	return nil
+}
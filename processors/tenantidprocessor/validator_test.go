@@ -0,0 +1,107 @@
+package tenantidprocessor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestNewTenantIDValidatorDisabled(t *testing.T) {
+	assert.Nil(t, newTenantIDValidator(ValidationConfig{Action: ValidationActionQuarantine}, zap.NewNop(), createTelemetryBuilder(t)))
+}
+
+func TestTenantIDValidator(t *testing.T) {
+	allowlistFile := filepath.Join(t.TempDir(), "allowlist.yaml")
+	require.NoError(t, os.WriteFile(allowlistFile, []byte("- tenant-from-file\n"), 0600))
+
+	tests := []struct {
+		name         string
+		cfg          ValidationConfig
+		tenantID     string
+		wantTenantID string
+		wantErr      string
+	}{
+		{
+			name:         "matches pattern",
+			cfg:          ValidationConfig{Pattern: "^[a-z0-9-]+$"},
+			tenantID:     "tenant-1",
+			wantTenantID: "tenant-1",
+		},
+		{
+			name:     "does not match pattern",
+			cfg:      ValidationConfig{Pattern: "^[a-z0-9-]+$"},
+			tenantID: "Tenant 1",
+			wantErr:  "failed pattern validation",
+		},
+		{
+			name:     "too long",
+			cfg:      ValidationConfig{MaxLength: 8},
+			tenantID: strings.Repeat("a", 9),
+			wantErr:  "failed max_length validation",
+		},
+		{
+			name:         "inline allowlist",
+			cfg:          ValidationConfig{Allowlist: []string{"tenant-1"}, AllowlistFile: allowlistFile},
+			tenantID:     "tenant-1",
+			wantTenantID: "tenant-1",
+		},
+		{
+			name:         "file allowlist",
+			cfg:          ValidationConfig{Allowlist: []string{"tenant-1"}, AllowlistFile: allowlistFile},
+			tenantID:     "tenant-from-file",
+			wantTenantID: "tenant-from-file",
+		},
+		{
+			name:     "not allowed",
+			cfg:      ValidationConfig{Allowlist: []string{"tenant-1"}, AllowlistFile: allowlistFile},
+			tenantID: "tenant-2",
+			wantErr:  "failed allowlist validation",
+		},
+		{
+			name:         "quarantine",
+			cfg:          ValidationConfig{Allowlist: []string{"tenant-1"}, Action: ValidationActionQuarantine, QuarantineTenantID: "quarantine"},
+			tenantID:     "tenant-2",
+			wantTenantID: "quarantine",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTenantIDValidator(tt.cfg, zap.NewNop(), createTelemetryBuilder(t))
+			require.NoError(t, v.start(context.Background()))
+			defer v.shutdown(context.Background())
+
+			tenantID, err := v.validate(context.Background(), tt.tenantID)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantTenantID, tenantID)
+			}
+		})
+	}
+}
+
+func TestProcessTracesInvalidTenantID(t *testing.T) {
+	p := &tenantIdProcessor{
+		logger:               zap.NewNop(),
+		tenantIDHeaderName:   defaultHeaderName,
+		tenantIDAttributeKey: defaultAttributeKey,
+		validator:            newTenantIDValidator(ValidationConfig{MaxLength: 4}, zap.NewNop(), createTelemetryBuilder(t)),
+		telemetryBuilder:     createTelemetryBuilder(t),
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{defaultHeaderName: testTenantID + "-too-long"}))
+
+	_, err := p.ProcessTraces(ctx, generateTraceDataOneSpan())
+	assert.ErrorContains(t, err, "invalid tenant ID")
+
+	_, err = p.ProcessTraces(ctx, ptrace.NewTraces())
+	assert.NoError(t, err)
+}
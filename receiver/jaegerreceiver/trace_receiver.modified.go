@@ -9,8 +9,10 @@ import (
 	"fmt"
 	"html"
 	"io"
+	"math"
 	"mime"
 	"net/http"
+	"strconv"
 	"sync"
 
 	apacheThrift "github.com/apache/thrift/lib/go/thrift"
@@ -35,8 +37,11 @@ import (
 	"go.opentelemetry.io/collector/receiver"
 	"go.opentelemetry.io/collector/receiver/receiverhelper"
 	"go.uber.org/multierr"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	jaegertranslator "github.com/open-telemetry/opentelemetry-collector-contrib/pkg/translator/jaeger"
 )
@@ -375,13 +380,28 @@ func (jr *jReceiver) HandleThriftHTTPBatch(w http.ResponseWriter, r *http.Reques
 
 	numSpans, err := consumeTraces(ctx, batch, jr.nextConsumer)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Cannot submit Jaeger batch: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Cannot submit Jaeger batch: %v", err), httpStatusCode(w, err))
 	} else {
 		w.WriteHeader(http.StatusAccepted)
 	}
 	jr.httpObsrecv.EndTracesOp(ctx, thriftFormat, numSpans, err)
 }
 
+// httpStatusCode maps throttling errors of the pipeline to 429 with a Retry-After
+// header when the error carries a retry delay, anything else to 500.
+func httpStatusCode(w http.ResponseWriter, err error) int {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return http.StatusInternalServerError
+	}
+	for _, detail := range st.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok && retryInfo.GetRetryDelay().AsDuration() > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryInfo.GetRetryDelay().AsDuration().Seconds())), 10))
+		}
+	}
+	return http.StatusTooManyRequests
+}
+
 func (jr *jReceiver) startCollector(ctx context.Context, host component.Host) error {
 	if jr.config == nil {
 		return nil
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -33,9 +34,13 @@ import (
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/receiver/receivertest"
 	conventions "go.opentelemetry.io/collector/semconv/v1.27.0"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/common/testutil"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/translator/jaeger"
@@ -109,6 +114,30 @@ func TestReception(t *testing.T) {
 	assert.EqualValues(t, td, gotTraces[0])
 }
 
+func TestHTTPStatusCode(t *testing.T) {
+	withRetryInfo, err := status.New(codes.ResourceExhausted, "over limit").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		err            error
+		wantStatusCode int
+		wantRetryAfter string
+	}{
+		{name: "error", err: errors.New("failed"), wantStatusCode: http.StatusInternalServerError},
+		{name: "unavailable", err: status.Error(codes.Unavailable, "unavailable"), wantStatusCode: http.StatusInternalServerError},
+		{name: "resource exhausted", err: status.Error(codes.ResourceExhausted, "over limit"), wantStatusCode: http.StatusTooManyRequests},
+		{name: "resource exhausted with retry info", err: withRetryInfo.Err(), wantStatusCode: http.StatusTooManyRequests, wantRetryAfter: "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			assert.Equal(t, tt.wantStatusCode, httpStatusCode(w, tt.err))
+			assert.Equal(t, tt.wantRetryAfter, w.Header().Get("Retry-After"))
+		})
+	}
+}
+
 func TestPortsNotOpen(t *testing.T) {
 	// an empty config should result in no open ports
 	config := &configuration{}